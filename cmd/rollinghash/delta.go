@@ -1,24 +1,141 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+
 	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/signature"
+	"github.com/SDkie/rollinghash/pkg/util"
 	"github.com/spf13/cobra"
 )
 
-func getDeltaCmd() *cobra.Command {
+func getDeltaCmd(flags *logFlags) *cobra.Command {
+	var formatName, hashName, checksumName string
+	var jobs int
+	var mmap, force, jsonStats, ignoreMismatch bool
+
 	deltaCmd := &cobra.Command{
 		Use:   "delta",
 		Short: "Generate delta between original and updated file",
-		Args:  cobra.ExactArgs(4),
-		Run: func(cmd *cobra.Command, args []string) {
-			delta.GenerateDelta(args[0], args[1], args[2], args[3])
+		Args:  exactArgs(4),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := flags.logger(cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			jobs, err = getJobs(jobs)
+			if err != nil {
+				return err
+			}
+			fileFormat, err := format.ParseType(formatName)
+			if err != nil {
+				return usageError{err}
+			}
+			checksum, err := signature.ParseStrongHashType(checksumName)
+			if err != nil {
+				return usageError{err}
+			}
+			opts := delta.Options{Format: fileFormat, Checksum: checksum, IgnoreSignatureMismatch: ignoreMismatch, Jobs: jobs, Mmap: mmap, Overwrite: force, Stdin: cmd.InOrStdin(), Stdout: cmd.OutOrStdout(), Logger: logger}
+			if cmd.Flags().Changed("hash") {
+				hashType, err := rollinghash.ParseType(hashName)
+				if err != nil {
+					return usageError{err}
+				}
+				opts.HashType = &hashType
+			}
+
+			cmd.SilenceUsage = true
+			stats, err := delta.GenerateDelta(args[0], args[1], args[2], args[3], &opts)
+			if err != nil {
+				return err
+			}
+
+			// the statistics don't mix with a delta file written to stdout
+			w := cmd.OutOrStdout()
+			if args[3] == util.StdioName {
+				w = cmd.ErrOrStderr()
+			}
+			info := newStatsInfo(stats)
+			if jsonStats {
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+			info.print(w)
+			return nil
 		},
 	}
+	deltaCmd.Flags().StringVar(&formatName, "format", "native", "format of the delta file (native, librsync), librsync deltas are applied by rdiff patch")
+	deltaCmd.Flags().StringVar(&hashName, "hash", "rabinkarp", "rolling hash of legacy signatures (rabinkarp, rollsum, buzhash, gear, rabinkarp64), must match the hash recorded in other signatures")
+
+	deltaCmd.Flags().StringVar(&checksumName, "checksum", "none", "strong hash of the original and updated files recorded in the delta and verified by patch (none, blake2b, sha256, xxh3), none with --format librsync")
+
+	deltaCmd.Flags().BoolVar(&ignoreMismatch, "ignore-signature-mismatch", false, "generate the delta when the original file doesn't match the checksum of the signature")
+
+	deltaCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of goroutines searching segments of the updated file, 0 uses all the CPUs (ignored for content defined chunks)")
+
+	deltaCmd.Flags().BoolVar(&mmap, "mmap", false, "memory map the original and updated files, they are read when they can't be mapped")
+
+	deltaCmd.Flags().BoolVarP(&force, "force", "f", false, "replace the delta file if it exists")
+
+	deltaCmd.Flags().BoolVar(&jsonStats, "stats", false, "print the statistics of the delta as JSON")
 
 	deltaCmd.SetUsageFunc(func(cmd *cobra.Command) error {
-		cmd.Println("Usage: rollinghash delta <original_file> <signature_file> <updated_file> <delta_file>")
+		cmd.Println("Usage: rollinghash delta [--format native|librsync] [--hash rabinkarp|rollsum|buzhash|gear|rabinkarp64] [--checksum none|blake2b|sha256|xxh3] [--ignore-signature-mismatch] [--jobs n] [--mmap] [--force] [--stats] <original_file> <signature_file> <updated_file> <delta_file>")
+		cmd.Println("original_file can be empty (\"\") when the signature contains strong hashes")
+		cmd.Println("signature_file can also be a librsync signature written by rdiff signature")
+		cmd.Println("signature_file or updated_file can be \"-\" for stdin and delta_file \"-\" for stdout, the statistics are then printed to stderr")
+		cmd.Println("original_file is read at random offsets and can't be \"-\"")
+		printGlobalFlags(cmd)
 		return nil
 	})
 
 	return deltaCmd
 }
+
+// statsInfo is the statistics of a delta printed by delta
+type statsInfo struct {
+	UpdatedBytes     uint64  `json:"updatedBytes"`
+	MatchedBytes     uint64  `json:"matchedBytes"`
+	LiteralBytes     uint64  `json:"literalBytes"`
+	MatchRecords     uint64  `json:"matchRecords"`
+	LiteralRecords   uint64  `json:"literalRecords"`
+	WeakHashHits     uint64  `json:"weakHashHits"`
+	FalsePositives   uint64  `json:"falsePositives"`
+	DeltaBytes       uint64  `json:"deltaBytes"`
+	MatchRatio       float64 `json:"matchRatio"`
+	CompressionRatio float64 `json:"compressionRatio"`
+	// ElapsedMs is the elapsed time in milliseconds
+	ElapsedMs float64 `json:"elapsedMs"`
+}
+
+func newStatsInfo(s *delta.Stats) *statsInfo {
+	return &statsInfo{
+		UpdatedBytes:     s.UpdatedBytes(),
+		MatchedBytes:     s.MatchedBytes,
+		LiteralBytes:     s.LiteralBytes,
+		MatchRecords:     s.MatchRecords,
+		LiteralRecords:   s.LiteralRecords,
+		WeakHashHits:     s.WeakHashHits,
+		FalsePositives:   s.FalsePositives,
+		DeltaBytes:       s.DeltaBytes,
+		MatchRatio:       s.MatchRatio(),
+		CompressionRatio: s.CompressionRatio(),
+		ElapsedMs:        float64(s.Elapsed.Microseconds()) / 1000,
+	}
+}
+
+func (s *statsInfo) print(w io.Writer) {
+	fmt.Fprintf(w, "updated bytes: %d\n", s.UpdatedBytes)
+	fmt.Fprintf(w, "matched bytes: %d (%.2f%%)\n", s.MatchedBytes, 100*s.MatchRatio)
+	fmt.Fprintf(w, "literal bytes: %d\n", s.LiteralBytes)
+	fmt.Fprintf(w, "match records: %d\n", s.MatchRecords)
+	fmt.Fprintf(w, "literal records: %d\n", s.LiteralRecords)
+	fmt.Fprintf(w, "weak hash hits: %d (%d false positives)\n", s.WeakHashHits, s.FalsePositives)
+	fmt.Fprintf(w, "delta bytes: %d (%.2f%% of the updated file)\n", s.DeltaBytes, 100*s.CompressionRatio)
+	fmt.Fprintf(w, "elapsed: %.3fms\n", s.ElapsedMs)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+// Exit codes of the rollinghash CLI
+// every sentinel error of the library has its own exit code,
+// other errors exit with EXIT_ERROR
+const (
+	EXIT_OK    = 0
+	EXIT_ERROR = 1
+	// invalid arguments or flags
+	EXIT_USAGE = 2
+	// an input file does not exist
+	EXIT_FILE_NOT_FOUND = 3
+	// the output file already exists
+	EXIT_FILE_EXISTS = 4
+
+	EXIT_EMPTY_INPUT_FILE       = 10
+	EXIT_INVALID_SIGNATURE_FILE = 11
+	EXIT_INVALID_CHUNK_SIZE     = 12
+
+	EXIT_EMPTY_ORIGINAL_FILE   = 20
+	EXIT_EMPTY_UPDATED_FILE    = 21
+	EXIT_MISSING_ORIGINAL_FILE = 22
+	EXIT_HASH_TYPE_MISMATCH    = 23
+	EXIT_SIGNATURE_MISMATCH    = 24
+
+	EXIT_INVALID_DELTA_FILE = 30
+	EXIT_CHUNK_LEN_MISMATCH = 31
+	EXIT_ORIGINAL_MISMATCH  = 32
+	EXIT_UPDATED_MISMATCH   = 33
+)
+
+// exitCodes maps the errors to their exit codes, the first matching error is used
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{err: signature.ErrEmptyInputFile, code: EXIT_EMPTY_INPUT_FILE},
+	{err: signature.ErrInvalidSignatureFile, code: EXIT_INVALID_SIGNATURE_FILE},
+	{err: signature.ErrInvalidChunkSize, code: EXIT_INVALID_CHUNK_SIZE},
+	{err: delta.ErrEmptyOriginalFile, code: EXIT_EMPTY_ORIGINAL_FILE},
+	{err: delta.ErrEmptyUpdatedFile, code: EXIT_EMPTY_UPDATED_FILE},
+	{err: delta.ErrMissingOriginalFile, code: EXIT_MISSING_ORIGINAL_FILE},
+	{err: delta.ErrHashTypeMismatch, code: EXIT_HASH_TYPE_MISMATCH},
+	{err: delta.ErrSignatureMismatch, code: EXIT_SIGNATURE_MISMATCH},
+	{err: delta.ErrInvalidDeltaFile, code: EXIT_INVALID_DELTA_FILE},
+	{err: delta.ErrChunkLenMismatch, code: EXIT_CHUNK_LEN_MISMATCH},
+	{err: delta.ErrOriginalMismatch, code: EXIT_ORIGINAL_MISMATCH},
+	{err: delta.ErrUpdatedMismatch, code: EXIT_UPDATED_MISMATCH},
+	{err: rollinghash.ErrUnknownType, code: EXIT_USAGE},
+	{err: signature.ErrUnknownStrongHash, code: EXIT_USAGE},
+	{err: format.ErrUnknownType, code: EXIT_USAGE},
+	{err: format.ErrLibrsyncUnsupported, code: EXIT_USAGE},
+	{err: delta.ErrStdinOriginalFile, code: EXIT_USAGE},
+	{err: delta.ErrStdinReadTwice, code: EXIT_USAGE},
+	{err: fs.ErrNotExist, code: EXIT_FILE_NOT_FOUND},
+	{err: fs.ErrExist, code: EXIT_FILE_EXISTS},
+}
+
+// usageError is returned for invalid arguments and flags
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the exit code for err
+func exitCode(err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		return EXIT_USAGE
+	}
+	for _, e := range exitCodes {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+	return EXIT_ERROR
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/signature"
+	"github.com/SDkie/rollinghash/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var errUnknownFileType = errors.New("the type of files without header can't be detected, use --type signature or --type delta")
+
+func getInspectCmd(flags *logFlags) *cobra.Command {
+	var fileType string
+	var jsonOutput bool
+
+	inspectCmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Print the content of a signature or delta file",
+		Args:  exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := flags.logger(cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			if fileType != "auto" && fileType != "signature" && fileType != "delta" {
+				return usageError{fmt.Errorf("unknown file type: %s", fileType)}
+			}
+			cmd.SilenceUsage = true
+
+			input := cmd.InOrStdin()
+			if args[0] != util.StdioName {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				input = file
+			}
+
+			r := bufio.NewReader(input)
+			if fileType == "auto" {
+				fileType, err = detectFileType(r)
+				if err != nil {
+					return err
+				}
+			}
+
+			var info interface{ print(w io.Writer) }
+			if fileType == "signature" {
+				info, err = inspectSignatureFile(r, logger)
+			} else {
+				info, err = inspectDeltaFile(r, logger)
+			}
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+			info.print(cmd.OutOrStdout())
+			return nil
+		},
+	}
+	inspectCmd.Flags().StringVar(&fileType, "type", "auto", "type of the file (auto, signature, delta), files without header are not detected")
+	inspectCmd.Flags().BoolVar(&jsonOutput, "json", false, "print the content as JSON")
+
+	inspectCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		cmd.Println("Usage: rollinghash inspect [--type auto|signature|delta] [--json] <file>")
+		cmd.Println("file can be \"-\" for stdin")
+		printGlobalFlags(cmd)
+		return nil
+	})
+
+	return inspectCmd
+}
+
+// detectFileType returns the type of the file from its magic, librsync files are also detected
+func detectFileType(r *bufio.Reader) (string, error) {
+	if magic, ok := format.PeekLibrsyncMagic(r); ok {
+		if magic == format.RS_DELTA_MAGIC {
+			return "delta", nil
+		}
+		return "signature", nil
+	}
+	magic, err := r.Peek(len(format.SignatureMagic))
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	switch string(magic) {
+	case format.SignatureMagic:
+		return "signature", nil
+	case format.DeltaMagic:
+		return "delta", nil
+	default:
+		return "", usageError{errUnknownFileType}
+	}
+}
+
+// signatureInfo is the content of a signature file printed by inspect
+type signatureInfo struct {
+	Type       string `json:"type"`
+	Format     string `json:"format"`
+	Version    uint16 `json:"version"`
+	Flags      uint16 `json:"flags"`
+	Hash       string `json:"hash"`
+	HashWidth  int    `json:"hashWidth"`
+	StrongHash string `json:"strongHash"`
+	// StrongLen is only set for librsync signatures, their strong hashes can be truncated
+	StrongLen   uint32 `json:"strongLen,omitempty"`
+	ChunkLen    uint32 `json:"chunkLen"`
+	MinChunkLen uint32 `json:"minChunkLen,omitempty"`
+	MaxChunkLen uint32 `json:"maxChunkLen,omitempty"`
+	Chunks      uint32 `json:"chunks"`
+	// Size is only known for content defined chunks or with a checksum
+	Size uint64 `json:"size,omitempty"`
+	// only for signatures with a checksum, the digest is hex encoded
+	Checksum string     `json:"checksum,omitempty"`
+	ModTime  *time.Time `json:"modTime,omitempty"`
+	Digest   string     `json:"digest,omitempty"`
+}
+
+// inspectSignatureFile reads the signature file from r
+func inspectSignatureFile(r io.Reader, logger *slog.Logger) (*signatureInfo, error) {
+	sr, err := signature.NewReader(r, &signature.Options{Logger: logger})
+	if err != nil {
+		return nil, err
+	}
+
+	header := sr.Header()
+	info := &signatureInfo{
+		Type:        "signature",
+		Format:      header.Format.String(),
+		Version:     header.Version,
+		Flags:       header.Flags,
+		Hash:        header.HashType.String(),
+		HashWidth:   32,
+		StrongHash:  header.StrongHash.String(),
+		ChunkLen:    header.ChunkLen,
+		MinChunkLen: header.MinChunkLen,
+		MaxChunkLen: header.MaxChunkLen,
+		StrongLen:   header.StrongLen,
+	}
+	if header.Flags&signature.FLAG_HASH64 != 0 {
+		info.HashWidth = 64
+	}
+	for {
+		c, err := sr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		info.Chunks++
+		info.Size += uint64(c.Len)
+	}
+	if header.Flags&signature.FLAG_CHECKSUM != 0 {
+		// the checksum follows the chunks
+		header = sr.Header()
+		info.Checksum = header.Checksum.String()
+		info.Size = header.Size
+		info.Digest = hex.EncodeToString(header.Digest)
+		if !header.ModTime.IsZero() {
+			info.ModTime = &header.ModTime
+		}
+	}
+	return info, nil
+}
+
+func (s *signatureInfo) print(w io.Writer) {
+	fmt.Fprintf(w, "type: %s\n", s.Type)
+	// librsync signatures have no version and flags
+	if s.Format == format.LIBRSYNC.String() {
+		fmt.Fprintf(w, "format: %s\n", s.Format)
+	} else {
+		fmt.Fprintf(w, "version: %d\n", s.Version)
+		fmt.Fprintf(w, "flags: %#04x\n", s.Flags)
+	}
+	fmt.Fprintf(w, "hash: %s (%d bits)\n", s.Hash, s.HashWidth)
+	if s.StrongLen != 0 {
+		fmt.Fprintf(w, "strong hash: %s (%d bytes)\n", s.StrongHash, s.StrongLen)
+	} else {
+		fmt.Fprintf(w, "strong hash: %s\n", s.StrongHash)
+	}
+	if s.Flags&signature.FLAG_VARIABLE_CHUNKS != 0 {
+		fmt.Fprintf(w, "chunk length: %d (content defined, min %d, max %d)\n", s.ChunkLen, s.MinChunkLen, s.MaxChunkLen)
+	} else {
+		fmt.Fprintf(w, "chunk length: %d\n", s.ChunkLen)
+	}
+	fmt.Fprintf(w, "chunks: %d\n", s.Chunks)
+	if s.Size != 0 {
+		fmt.Fprintf(w, "size: %d\n", s.Size)
+	}
+	if s.Checksum == "" {
+		return
+	}
+	fmt.Fprintf(w, "checksum: %s  %s\n", s.Checksum, s.Digest)
+	if s.ModTime != nil {
+		fmt.Fprintf(w, "modification time: %s\n", s.ModTime.Format(time.RFC3339Nano))
+	}
+}
+
+// deltaInfo is the content of a delta file printed by inspect
+type deltaInfo struct {
+	Type     string       `json:"type"`
+	Format   string       `json:"format"`
+	Version  uint16       `json:"version"`
+	Flags    uint16       `json:"flags"`
+	ChunkLen uint32       `json:"chunkLen"`
+	Records  []recordInfo `json:"records"`
+	// Size is the size of the updated file
+	Size uint64 `json:"size"`
+	// UpperBound is set when the size of the original file is unknown, the last chunk of the original file
+	// can be shorter than the chunk length, so the lengths and offsets from MATCH records are upper bounds.
+	// Size is exact for deltas with checksums.
+	UpperBound bool `json:"upperBound,omitempty"`
+	// only for deltas with checksums, the digests are hex encoded
+	Checksum       string  `json:"checksum,omitempty"`
+	OriginalSize   *uint64 `json:"originalSize,omitempty"`
+	OriginalDigest string  `json:"originalDigest,omitempty"`
+	UpdatedDigest  string  `json:"updatedDigest,omitempty"`
+}
+
+// recordInfo is a record of a delta file printed by inspect
+// Offset is the offset of the record in the updated file,
+// the last chunk of the original file is counted with the full chunk length when the original size is unknown.
+type recordInfo struct {
+	Cmd    string `json:"cmd"`
+	Offset uint64 `json:"offset"`
+	Len    uint64 `json:"len"`
+	// only for MATCH records
+	StartChunkIndex *uint64 `json:"startChunkIndex,omitempty"`
+	EndChunkIndex   *uint64 `json:"endChunkIndex,omitempty"`
+	// only for COPY records
+	OriginalOffset *uint64 `json:"originalOffset,omitempty"`
+}
+
+// inspectDeltaFile reads the delta file from r
+func inspectDeltaFile(r io.Reader, logger *slog.Logger) (*deltaInfo, error) {
+	dr, err := delta.NewReader(r, &delta.Options{Logger: logger})
+	if err != nil {
+		return nil, err
+	}
+
+	header := dr.Header()
+	info := &deltaInfo{
+		Type:     "delta",
+		Format:   header.Format.String(),
+		Version:  header.Version,
+		Flags:    header.Flags,
+		ChunkLen: header.ChunkLen,
+		Records:  []recordInfo{},
+	}
+	if header.Flags&delta.FLAG_CHECKSUM != 0 {
+		info.Checksum = header.Checksum.String()
+	}
+	if header.Flags&delta.FLAG_ORIGINAL_CHECKSUM != 0 {
+		info.OriginalSize = &header.OriginalSize
+		info.OriginalDigest = hex.EncodeToString(header.OriginalDigest)
+	}
+	for {
+		record, err := dr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return info, nil
+			}
+			return nil, err
+		}
+
+		if record.Cmd == delta.CHECKSUM {
+			info.UpdatedDigest = hex.EncodeToString(record.Digest)
+			info.Size = record.Len
+			continue
+		}
+
+		ri := recordInfo{Cmd: record.Cmd.String(), Offset: info.Size, Len: record.Len}
+		switch record.Cmd {
+		case delta.MATCH:
+			ri.StartChunkIndex = &record.StartChunkIndex
+			ri.EndChunkIndex = &record.EndChunkIndex
+			ri.Len = matchLen(record, header)
+			if header.Flags&delta.FLAG_ORIGINAL_CHECKSUM == 0 {
+				info.UpperBound = true
+			}
+		case delta.COPY:
+			ri.OriginalOffset = &record.Offset
+		}
+		info.Records = append(info.Records, ri)
+		info.Size += ri.Len
+	}
+}
+
+// matchLen returns the length of the MATCH record r
+// the last chunk of the original file is shorter when the size of the original file is known
+func matchLen(r delta.Record, header delta.Header) uint64 {
+	start := r.StartChunkIndex * uint64(header.ChunkLen)
+	end := (r.EndChunkIndex + 1) * uint64(header.ChunkLen)
+	if header.Flags&delta.FLAG_ORIGINAL_CHECKSUM != 0 {
+		end = min(end, header.OriginalSize)
+	}
+	if end < start {
+		return 0
+	}
+	return end - start
+}
+
+func (d *deltaInfo) print(w io.Writer) {
+	fmt.Fprintf(w, "type: %s\n", d.Type)
+	// librsync deltas have no version, flags and chunk length
+	if d.Format == format.LIBRSYNC.String() {
+		fmt.Fprintf(w, "format: %s\n", d.Format)
+	} else {
+		fmt.Fprintf(w, "version: %d\n", d.Version)
+		fmt.Fprintf(w, "flags: %#04x\n", d.Flags)
+		fmt.Fprintf(w, "chunk length: %d\n", d.ChunkLen)
+	}
+	fmt.Fprintf(w, "records: %d\n", len(d.Records))
+	for _, r := range d.Records {
+		switch {
+		case r.StartChunkIndex != nil:
+			fmt.Fprintf(w, "  %12d  %-7s  len %d  chunks %d-%d\n", r.Offset, r.Cmd, r.Len, *r.StartChunkIndex, *r.EndChunkIndex)
+		case r.OriginalOffset != nil:
+			fmt.Fprintf(w, "  %12d  %-7s  len %d  original offset %d\n", r.Offset, r.Cmd, r.Len, *r.OriginalOffset)
+		default:
+			fmt.Fprintf(w, "  %12d  %-7s  len %d\n", r.Offset, r.Cmd, r.Len)
+		}
+	}
+	if d.UpperBound {
+		fmt.Fprintf(w, "MATCH lengths and offsets are upper bounds, the last chunk of the original file can be shorter\n")
+	}
+	if d.UpperBound && d.Checksum == "" {
+		fmt.Fprintf(w, "size: at most %d\n", d.Size)
+	} else {
+		fmt.Fprintf(w, "size: %d\n", d.Size)
+	}
+	if d.Checksum == "" {
+		return
+	}
+	fmt.Fprintf(w, "checksum: %s\n", d.Checksum)
+	if d.OriginalSize != nil {
+		fmt.Fprintf(w, "original: %s  size %d\n", d.OriginalDigest, *d.OriginalSize)
+	}
+	fmt.Fprintf(w, "updated: %s  size %d\n", d.UpdatedDigest, d.Size)
+}
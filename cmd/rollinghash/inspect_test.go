@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	const testdata = "../../pkg/delta/testdata/"
+	const sigTestdata = "../../pkg/signature/testdata/"
+
+	test8Delta := `type: delta
+version: 1
+flags: 0x0000
+chunk length: 256
+records: 5
+             0  LITERAL  len 5
+             5  MATCH    len 256  chunks 0-0
+           261  LITERAL  len 4
+           265  MATCH    len 256  chunks 1-1
+           521  LITERAL  len 8
+MATCH lengths and offsets are upper bounds, the last chunk of the original file can be shorter
+size: at most 529
+`
+
+	cases := []struct {
+		name      string
+		args      []string
+		expCode   int
+		expStdout func(stdout []byte) bool
+	}{
+		// Happy Paths
+		{name: "Delta", args: []string{"inspect", testdata + "test8.delta"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool { return string(stdout) == test8Delta }},
+		{name: "Legacy delta", args: []string{"inspect", "--type", "delta", testdata + "test8.v0.delta"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				return bytes.Contains(stdout, []byte("version: 0\n")) && bytes.HasSuffix(stdout, []byte("size: at most 529\n"))
+			}},
+		{name: "Delta as json", args: []string{"inspect", "--json", testdata + "test8.delta"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				var info deltaInfo
+				err := json.Unmarshal(stdout, &info)
+				return err == nil && info.Type == "delta" && info.ChunkLen == 256 && len(info.Records) == 5 &&
+					info.Records[3].Cmd == "MATCH" && info.Records[3].Offset == 265 && *info.Records[3].StartChunkIndex == 1 && info.Size == 529
+			}},
+		{name: "Delta with checksums", args: []string{"inspect", testdata + "test8.checksum.delta"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				return bytes.Contains(stdout, []byte("records: 5\n")) && bytes.HasSuffix(stdout, []byte("size: 529\nchecksum: blake2b\n"+
+					"original: 59ac3ab5aa7db08d69a8b7b6c85cdbecb23519f80773353045115e9195390378  size 512\n"+
+					"updated: a050dc0ebaec84664fdf3827801ba58051fa156879fd005dfc1b480d33eb190d  size 529\n"))
+			}},
+		{name: "Signature", args: []string{"inspect", sigTestdata + "test5.sig"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				return bytes.Contains(stdout, []byte("type: signature\n")) && bytes.Contains(stdout, []byte("chunk length: 384\nchunks: 521\n"))
+			}},
+		{name: "Signature with strong hash as json", args: []string{"inspect", "--json", sigTestdata + "test5.blake2b.sig"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				var info signatureInfo
+				err := json.Unmarshal(stdout, &info)
+				return err == nil && info.Type == "signature" && info.StrongHash == "blake2b" && info.HashWidth == 32 && info.ChunkLen == 384 && info.Chunks == 521
+			}},
+		{name: "Signature with checksum", args: []string{"inspect", sigTestdata + "test2.checksum.sig"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				return bytes.HasSuffix(stdout, []byte("chunks: 2\nsize: 512\nchecksum: blake2b  59ac3ab5aa7db08d69a8b7b6c85cdbecb23519f80773353045115e9195390378\n"))
+			}},
+		{name: "librsync delta", args: []string{"inspect", testdata + "test8.rdiff.delta"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				return bytes.HasPrefix(stdout, []byte("type: delta\nformat: librsync\nrecords: 5\n")) &&
+					bytes.Contains(stdout, []byte("COPY     len 256  original offset 256\n")) && bytes.HasSuffix(stdout, []byte("size: 529\n"))
+			}},
+		{name: "librsync signature", args: []string{"inspect", sigTestdata + "test2.rdiff-blake2-8.sig"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				return string(stdout) == "type: signature\nformat: librsync\nhash: rollsum (32 bits)\nstrong hash: blake2b (8 bytes)\nchunk length: 256\nchunks: 2\n"
+			}},
+		{name: "librsync signature as json", args: []string{"inspect", "--json", sigTestdata + "test5.rdiff-rk-md4.sig"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool {
+				var info signatureInfo
+				err := json.Unmarshal(stdout, &info)
+				return err == nil && info.Format == "librsync" && info.Hash == "rabinkarp" && info.StrongHash == "md4" && info.StrongLen == 16 && info.ChunkLen == 2048 && info.Chunks == 98
+			}},
+		{name: "Legacy signature", args: []string{"inspect", "--type", "signature", sigTestdata + "test5.v0.sig"}, expCode: EXIT_OK,
+			expStdout: func(stdout []byte) bool { return bytes.Contains(stdout, []byte("chunks: 521\n")) }},
+
+		// Unhappy Paths
+		{name: "Legacy file type not detected", args: []string{"inspect", testdata + "test8.v0.delta"}, expCode: EXIT_USAGE,
+			expStdout: func(stdout []byte) bool { return len(stdout) == 0 }},
+		{name: "Unknown file type", args: []string{"inspect", "--type", "patch", testdata + "test8.delta"}, expCode: EXIT_USAGE,
+			expStdout: func(stdout []byte) bool { return !bytes.Contains(stdout, []byte("type: delta")) }},
+		{name: "Invalid delta file", args: []string{"inspect", testdata + "test106.delta"}, expCode: EXIT_INVALID_DELTA_FILE,
+			expStdout: func(stdout []byte) bool { return len(stdout) == 0 }},
+		{name: "Missing file", args: []string{"inspect", testdata + "missing.delta"}, expCode: EXIT_FILE_NOT_FOUND,
+			expStdout: func(stdout []byte) bool { return len(stdout) == 0 }},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(c.args, nil, &stdout, &stderr)
+			if code != c.expCode {
+				t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), c.expCode, code, stderr.String())
+			}
+			if !c.expStdout(stdout.Bytes()) {
+				t.Fatalf("'%s' Failed : unexpected stdout: %s", t.Name(), stdout.String())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestInspectShortLastChunk(t *testing.T) {
+	dir := t.TempDir()
+	out := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	// the last chunk of the 600 bytes original file has 88 bytes
+	original := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 17)[:600]
+	err := os.WriteFile(out("short.org"), original, 0666)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	err = os.WriteFile(out("short.update"), append([]byte("XYZ"), original...), 0666)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	setup := [][]string{
+		{"signature", "--chunk-size", "256", "--checksum", "none", out("short.org"), out("short.sig")},
+		{"delta", "--checksum", "blake2b", out("short.org"), out("short.sig"), out("short.update"), out("short.checksum.delta")},
+		{"delta", "--checksum", "none", out("short.org"), out("short.sig"), out("short.update"), out("short.delta")},
+	}
+	for _, args := range setup {
+		var stdout, stderr bytes.Buffer
+		code := run(args, nil, &stdout, &stderr)
+		if code != EXIT_OK {
+			t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), EXIT_OK, code, stderr.String())
+		}
+	}
+
+	cases := []struct {
+		name      string
+		deltafile string
+		expStdout []string
+	}{
+		// Happy Paths
+		{name: "Delta with checksums", deltafile: "short.checksum.delta", expStdout: []string{"             3  MATCH    len 600  chunks 0-2\nsize: 603\n", "  size 603\n"}},
+		{name: "Delta without checksums", deltafile: "short.delta", expStdout: []string{"             3  MATCH    len 768  chunks 0-2\n", "upper bounds", "size: at most 771\n"}},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run([]string{"inspect", out(c.deltafile)}, nil, &stdout, &stderr)
+			if code != EXIT_OK {
+				t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), EXIT_OK, code, stderr.String())
+			}
+			for _, expected := range c.expStdout {
+				if !bytes.Contains(stdout.Bytes(), []byte(expected)) {
+					t.Fatalf("'%s' Failed : expected %q in stdout: %s", t.Name(), expected, stdout.String())
+				}
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
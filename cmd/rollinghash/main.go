@@ -1,20 +1,116 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
 
 	"github.com/spf13/cobra"
 )
 
 func main() {
-	rootCmd := &cobra.Command{
-		Use:   "rollinghash",
-		Short: "rollinghash is a CLI tool to calculate signature and delta for files using rolling hash algorithm",
-	}
-	rootCmd.AddCommand(getSignatureCmd(), getDeltaCmd())
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command tree with args and returns the exit code
+// the file name "-" reads stdin or writes to stdout
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	rootCmd := getRootCmd()
+	rootCmd.SetArgs(args)
+	rootCmd.SetIn(stdin)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
 
 	err := rootCmd.Execute()
 	if err != nil {
-		log.Fatalf("error from cmd execution: %s", err)
+		fmt.Fprintf(stderr, "error: %s\n", err)
+	}
+	return exitCode(err)
+}
+
+func getRootCmd() *cobra.Command {
+	var flags logFlags
+
+	rootCmd := &cobra.Command{
+		Use:           "rollinghash",
+		Short:         "rollinghash is a CLI tool to calculate signature and delta for files using rolling hash algorithm",
+		SilenceErrors: true,
+	}
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
+	})
+	rootCmd.PersistentFlags().CountVarP(&flags.verbose, "verbose", "v", "log the progress to stderr, -vv also logs every chunk and hash probe")
+	rootCmd.PersistentFlags().StringVar(&flags.level, "log-level", "", "level of the logs to stderr (debug, info, warn, error), debug logs every chunk and hash probe")
+	rootCmd.PersistentFlags().StringVar(&flags.format, "log-format", "text", "format of the logs (text, json)")
+
+	rootCmd.AddCommand(getSignatureCmd(&flags), getDeltaCmd(&flags), getPatchCmd(&flags), getInspectCmd(&flags))
+	return rootCmd
+}
+
+// printGlobalFlags prints the usage of the flags shared by all the commands
+func printGlobalFlags(cmd *cobra.Command) {
+	cmd.Println("Global flags: [-v|-vv|--verbose] [--log-level debug|info|warn|error] [--log-format text|json]")
+}
+
+// logFlags contains the global logging flags
+type logFlags struct {
+	verbose int
+	level   string
+	format  string
+}
+
+// logger returns the logger selected by the flags writing to w
+// nil is returned when neither --verbose nor --log-level is set, so nothing is logged
+// --verbose logs at the Info level, the Debug level logs every chunk and hash probe, millions of lines per GB
+func (f *logFlags) logger(w io.Writer) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	if f.verbose > 1 {
+		level = slog.LevelDebug
+	}
+	if f.level != "" {
+		err := level.UnmarshalText([]byte(f.level))
+		if err != nil {
+			return nil, usageError{fmt.Errorf("unknown log level: %s", f.level)}
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch f.format {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, usageError{fmt.Errorf("unknown log format: %s", f.format)}
+	}
+
+	if f.verbose == 0 && f.level == "" {
+		return nil, nil
+	}
+	return slog.New(handler), nil
+}
+
+// exactArgs returns a usageError if there are not exactly n args
+func exactArgs(n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		err := cobra.ExactArgs(n)(cmd, args)
+		if err != nil {
+			return usageError{err}
+		}
+		return nil
+	}
+}
+
+// getJobs validates the --jobs flag, 0 uses all the CPUs
+func getJobs(jobs int) (int, error) {
+	if jobs < 0 {
+		return 0, usageError{fmt.Errorf("invalid number of jobs: %d", jobs)}
+	}
+	if jobs == 0 {
+		return runtime.NumCPU(), nil
 	}
+	return jobs, nil
 }
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/util"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	out := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	const testdata = "../../pkg/delta/testdata/"
+	err := os.WriteFile(out("empty"), nil, 0666)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	err = os.WriteFile(out("corrupt.sig"), []byte("RHSG\x00\x01"), 0666)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+
+	// cases run in order, later cases use the files created by earlier ones
+	cases := []struct {
+		name    string
+		args    []string
+		expCode int
+	}{
+		// Happy Paths
+		{name: "Signature", args: []string{"signature", testdata + "test5.org", out("test5.sig")}, expCode: EXIT_OK},
+		{name: "Signature with strong hash", args: []string{"signature", "--strong-hash", "sha256", testdata + "test5.org", out("test5.sha256.sig")}, expCode: EXIT_OK},
+		{name: "Signature with jobs", args: []string{"signature", "--jobs", "4", testdata + "test5.org", out("test5.jobs.sig")}, expCode: EXIT_OK},
+		{name: "Signature with 64 bits hashes", args: []string{"signature", "--hash", "rabinkarp64", "--hash-width", "64", testdata + "test5.org", out("test5.hash64.sig")}, expCode: EXIT_OK},
+		{name: "Signature with checksum", args: []string{"signature", "--checksum", "blake2b", testdata + "test5.org", out("test5.checksum.sig")}, expCode: EXIT_OK},
+		{name: "Signature with chunk size", args: []string{"signature", "--chunk-size", "64", testdata + "test5.org", out("test5.64.sig")}, expCode: EXIT_OK},
+		{name: "Signature with chunk size heuristic", args: []string{"signature", "--chunk-size-heuristic", "rsync", testdata + "test5.org", out("test5.rsync.sig")}, expCode: EXIT_OK},
+		{name: "Delta", args: []string{"delta", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("test5.delta")}, expCode: EXIT_OK},
+		{name: "Delta with jobs", args: []string{"delta", "--jobs", "0", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("test5.jobs.delta")}, expCode: EXIT_OK},
+		{name: "Delta with 64 bits hashes", args: []string{"delta", testdata + "test5.org", out("test5.hash64.sig"), testdata + "test5.update", out("test5.hash64.delta")}, expCode: EXIT_OK},
+		{name: "Delta with checksum", args: []string{"delta", "--checksum", "blake2b", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("test5.checksum.delta")}, expCode: EXIT_OK},
+		{name: "Patch with checksum", args: []string{"patch", testdata + "test5.org", out("test5.checksum.delta"), out("test5.checksum.update")}, expCode: EXIT_OK},
+		{name: "Delta verifying signature checksum", args: []string{"delta", testdata + "test5.org", out("test5.checksum.sig"), testdata + "test5.update", out("test5.verified.delta")}, expCode: EXIT_OK},
+		{name: "Delta with xxh3 checksum", args: []string{"delta", "--checksum", "xxh3", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("test5.xxh3.delta")}, expCode: EXIT_OK},
+		{name: "Patch with xxh3 checksum", args: []string{"patch", testdata + "test5.org", out("test5.xxh3.delta"), out("test5.xxh3.update")}, expCode: EXIT_OK},
+		{name: "Delta ignoring signature mismatch", args: []string{"delta", "--ignore-signature-mismatch", testdata + "test115.org", testdata + "test115.sig", testdata + "test115.update", out("test115.ignored.delta")}, expCode: EXIT_OK},
+		{name: "Delta with chunk size", args: []string{"delta", testdata + "test5.org", out("test5.64.sig"), testdata + "test5.update", out("test5.64.delta")}, expCode: EXIT_OK},
+		{name: "Patch with chunk size", args: []string{"patch", testdata + "test5.org", out("test5.64.delta"), out("test5.64.update")}, expCode: EXIT_OK},
+		{name: "Patch", args: []string{"patch", testdata + "test5.org", out("test5.delta"), out("test5.update")}, expCode: EXIT_OK},
+		{name: "Signature replacing existing file", args: []string{"signature", "--force", testdata + "test5.org", out("test5.sig")}, expCode: EXIT_OK},
+		{name: "Delta replacing existing file", args: []string{"delta", "-f", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("test5.delta")}, expCode: EXIT_OK},
+		{name: "Patch replacing existing file", args: []string{"patch", "--force", testdata + "test5.org", out("test5.delta"), out("test5.64.update")}, expCode: EXIT_OK},
+		{name: "librsync signature", args: []string{"signature", "--format", "librsync", testdata + "test5.org", out("test5.rdiff.sig")}, expCode: EXIT_OK},
+		{name: "librsync delta", args: []string{"delta", "--format", "librsync", "", out("test5.rdiff.sig"), testdata + "test5.update", out("test5.rdiff.delta")}, expCode: EXIT_OK},
+		{name: "Patch with librsync delta", args: []string{"patch", testdata + "test5.org", out("test5.rdiff.delta"), out("test5.rdiff.update")}, expCode: EXIT_OK},
+		{name: "Delta of rdiff signature", args: []string{"delta", testdata + "test8.org", testdata + "test8.rdiff.sig", testdata + "test8.update", out("test8.delta")}, expCode: EXIT_OK},
+		{name: "Patch with rdiff delta", args: []string{"patch", testdata + "test8.org", testdata + "test8.rdiff.delta", out("test8.update")}, expCode: EXIT_OK},
+
+		// Unhappy Paths
+		{name: "Missing args", args: []string{"signature", testdata + "test5.org"}, expCode: EXIT_USAGE},
+		{name: "Unknown flag", args: []string{"delta", "--unknown", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("unknown.delta")}, expCode: EXIT_USAGE},
+		{name: "Unknown hash", args: []string{"signature", "--hash", "unknown", testdata + "test5.org", out("unknown.sig")}, expCode: EXIT_USAGE},
+		{name: "Unknown strong hash", args: []string{"signature", "--strong-hash", "unknown", testdata + "test5.org", out("unknown.sig")}, expCode: EXIT_USAGE},
+		{name: "64 bits width with 32 bits hash", args: []string{"signature", "--hash-width", "64", testdata + "test5.org", out("width64.sig")}, expCode: EXIT_USAGE},
+		{name: "Invalid hash width", args: []string{"signature", "--hash-width", "16", testdata + "test5.org", out("width.sig")}, expCode: EXIT_USAGE},
+		{name: "Negative jobs", args: []string{"signature", "--jobs", "-1", testdata + "test5.org", out("jobs.sig")}, expCode: EXIT_USAGE},
+		{name: "Missing input file", args: []string{"signature", out("missing"), out("missing.sig")}, expCode: EXIT_FILE_NOT_FOUND},
+		{name: "Existing output file", args: []string{"signature", testdata + "test5.org", out("test5.sig")}, expCode: EXIT_FILE_EXISTS},
+		{name: "Existing delta file", args: []string{"delta", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("test5.delta")}, expCode: EXIT_FILE_EXISTS},
+		{name: "Empty input file", args: []string{"signature", out("empty"), out("empty.sig")}, expCode: EXIT_EMPTY_INPUT_FILE},
+		{name: "Unknown chunk size heuristic", args: []string{"signature", "--chunk-size-heuristic", "unknown", testdata + "test5.org", out("unknown.sig")}, expCode: EXIT_USAGE},
+		{name: "Chunk size below limit", args: []string{"signature", "--chunk-size", "32", testdata + "test5.org", out("small.sig")}, expCode: EXIT_INVALID_CHUNK_SIZE},
+		{name: "Invalid chunk size", args: []string{"signature", "--cdc", "--cdc-avg", "1000", testdata + "test5.org", out("cdc.sig")}, expCode: EXIT_INVALID_CHUNK_SIZE},
+		{name: "Invalid signature file", args: []string{"delta", testdata + "test5.org", out("corrupt.sig"), testdata + "test5.update", out("corrupt.delta")}, expCode: EXIT_INVALID_SIGNATURE_FILE},
+		{name: "Empty original file", args: []string{"delta", out("empty"), out("test5.sig"), testdata + "test5.update", out("empty.delta")}, expCode: EXIT_EMPTY_ORIGINAL_FILE},
+		{name: "Empty updated file", args: []string{"delta", testdata + "test5.org", out("test5.sig"), out("empty"), out("empty.delta")}, expCode: EXIT_EMPTY_UPDATED_FILE},
+		{name: "Missing original file", args: []string{"delta", "", out("test5.sig"), testdata + "test5.update", out("missing.delta")}, expCode: EXIT_MISSING_ORIGINAL_FILE},
+		{name: "Unknown signature checksum", args: []string{"signature", "--checksum", "unknown", testdata + "test5.org", out("unknown.sig")}, expCode: EXIT_USAGE},
+		{name: "Unknown checksum", args: []string{"delta", "--checksum", "unknown", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("unknown.delta")}, expCode: EXIT_USAGE},
+		{name: "Signature mismatch", args: []string{"delta", testdata + "test115.org", testdata + "test115.sig", testdata + "test115.update", out("test115.delta")}, expCode: EXIT_SIGNATURE_MISMATCH},
+		{name: "Hash type mismatch", args: []string{"delta", "--hash", "rollsum", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("mismatch.delta")}, expCode: EXIT_HASH_TYPE_MISMATCH},
+		{name: "Invalid delta file", args: []string{"patch", testdata + "test104.org", testdata + "test104.delta", out("test104.update")}, expCode: EXIT_INVALID_DELTA_FILE},
+		{name: "Chunk length mismatch", args: []string{"patch", testdata + "test103.org", testdata + "test103.delta", out("test103.update")}, expCode: EXIT_CHUNK_LEN_MISMATCH},
+		{name: "Original file mismatch", args: []string{"patch", testdata + "test112.org", testdata + "test112.delta", out("test112.update")}, expCode: EXIT_ORIGINAL_MISMATCH},
+		{name: "Updated file mismatch", args: []string{"patch", testdata + "test113.org", testdata + "test113.delta", out("test113.update")}, expCode: EXIT_UPDATED_MISMATCH},
+		{name: "Unknown format", args: []string{"signature", "--format", "rsync", testdata + "test5.org", out("unknown.sig")}, expCode: EXIT_USAGE},
+		{name: "librsync signature with unsupported hash", args: []string{"signature", "--format", "librsync", "--hash", "buzhash", testdata + "test5.org", out("buzhash.rdiff.sig")}, expCode: EXIT_USAGE},
+		{name: "librsync delta with checksum", args: []string{"delta", "--format", "librsync", "--checksum", "blake2b", testdata + "test5.org", out("test5.sig"), testdata + "test5.update", out("checksum.rdiff.delta")}, expCode: EXIT_USAGE},
+		{name: "Invalid librsync delta file", args: []string{"patch", testdata + "test118.org", testdata + "test118.delta", out("test118.update")}, expCode: EXIT_INVALID_DELTA_FILE},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(c.args, nil, &stdout, &stderr)
+			if code != c.expCode {
+				t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), c.expCode, code, stderr.String())
+			}
+			if code != EXIT_OK && stderr.Len() == 0 {
+				t.Fatalf("'%s' Failed : expected error on stderr", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+
+	updated, err := os.ReadFile(testdata + "test5.update")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	output, err := os.ReadFile(out("test5.update"))
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	if !bytes.Equal(output, updated) {
+		t.Fatalf("'%s' Failed : updated contents do not match", t.Name())
+	}
+	output, err = os.ReadFile(out("test5.64.update"))
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	if !bytes.Equal(output, updated) {
+		t.Fatalf("'%s' Failed : replaced contents do not match", t.Name())
+	}
+	output, err = os.ReadFile(out("test5.rdiff.update"))
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	if !bytes.Equal(output, updated) {
+		t.Fatalf("'%s' Failed : librsync contents do not match", t.Name())
+	}
+	match, err := util.CompareFileContents(out("test8.update"), testdata+"test8.update")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	if !match {
+		t.Fatalf("'%s' Failed : rdiff delta contents do not match", t.Name())
+	}
+
+	// failed commands leave neither output files nor temporary files behind
+	for _, name := range []string{"corrupt.delta", "mismatch.delta", "test104.update", "test103.update", "test112.update", "test113.update", "test115.delta", "buzhash.rdiff.sig", "checksum.rdiff.delta", "test118.update", "width64.sig"} {
+		_, err = os.Stat(out(name))
+		if !os.IsNotExist(err) {
+			t.Fatalf("'%s' Failed : expected no %s, got error:%v", t.Name(), name, err)
+		}
+	}
+	tmpFiles, err := filepath.Glob(out(".*.tmp"))
+	if err != nil || len(tmpFiles) != 0 {
+		t.Fatalf("'%s' Failed : expected no temporary files, got:%v (%v)", t.Name(), tmpFiles, err)
+	}
+}
+
+func TestRunLogging(t *testing.T) {
+	dir := t.TempDir()
+	input := "../../pkg/delta/testdata/test5.org"
+
+	cases := []struct {
+		name      string
+		args      []string
+		expCode   int
+		expStderr func(stderr []byte) bool
+	}{
+		// Happy Paths
+		{name: "No logs by default", args: []string{"signature", input, filepath.Join(dir, "default.sig")}, expCode: EXIT_OK,
+			expStderr: func(stderr []byte) bool { return len(stderr) == 0 }},
+		{name: "Verbose text logs", args: []string{"signature", "--verbose", input, filepath.Join(dir, "text.sig")}, expCode: EXIT_OK,
+			expStderr: func(stderr []byte) bool {
+				return bytes.Contains(stderr, []byte("level=INFO msg=signature")) && !bytes.Contains(stderr, []byte("level=DEBUG"))
+			}},
+		{name: "Verbose signature logs are bounded", args: []string{"-v", "signature", "--chunk-size", "64", input, filepath.Join(dir, "bounded.sig")}, expCode: EXIT_OK,
+			expStderr: func(stderr []byte) bool { return bytes.Count(stderr, []byte("\n")) < 10 }},
+		{name: "Verbose delta logs are bounded", args: []string{"-v", "delta", input, filepath.Join(dir, "bounded.sig"), "../../pkg/delta/testdata/test5.update", filepath.Join(dir, "bounded.delta")}, expCode: EXIT_OK,
+			expStderr: func(stderr []byte) bool { return bytes.Count(stderr, []byte("\n")) < 10 }},
+		{name: "Debug text logs", args: []string{"signature", "-vv", input, filepath.Join(dir, "debug.sig")}, expCode: EXIT_OK,
+			expStderr: func(stderr []byte) bool { return bytes.Contains(stderr, []byte("level=DEBUG msg=chunk")) }},
+		{name: "Debug log level", args: []string{"signature", "--log-level", "debug", input, filepath.Join(dir, "level.sig")}, expCode: EXIT_OK,
+			expStderr: func(stderr []byte) bool { return bytes.Contains(stderr, []byte("level=DEBUG msg=chunk")) }},
+		{name: "Error log level", args: []string{"signature", "--log-level", "error", input, filepath.Join(dir, "error.sig")}, expCode: EXIT_OK,
+			expStderr: func(stderr []byte) bool { return len(stderr) == 0 }},
+		{name: "Verbose json logs", args: []string{"-v", "--log-format", "json", "signature", input, filepath.Join(dir, "json.sig")}, expCode: EXIT_OK,
+			expStderr: func(stderr []byte) bool {
+				lines := bytes.Split(bytes.TrimSpace(stderr), []byte("\n"))
+				for _, line := range lines {
+					if !json.Valid(line) {
+						return false
+					}
+				}
+				return len(lines) > 1
+			}},
+
+		// Unhappy Paths
+		{name: "Unknown log level", args: []string{"signature", "--log-level", "trace", input, filepath.Join(dir, "trace.sig")}, expCode: EXIT_USAGE,
+			expStderr: func(stderr []byte) bool { return bytes.Contains(stderr, []byte("unknown log level")) }},
+		{name: "Unknown log format", args: []string{"signature", "--log-format", "xml", input, filepath.Join(dir, "xml.sig")}, expCode: EXIT_USAGE,
+			expStderr: func(stderr []byte) bool { return bytes.Contains(stderr, []byte("unknown log format")) }},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(c.args, nil, &stdout, &stderr)
+			if code != c.expCode {
+				t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), c.expCode, code, stderr.String())
+			}
+			if !c.expStderr(stderr.Bytes()) {
+				t.Fatalf("'%s' Failed : unexpected stderr: %s", t.Name(), stderr.String())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestRunDeltaStats(t *testing.T) {
+	dir := t.TempDir()
+	const testdata = "../../pkg/delta/testdata/"
+	deltaArgs := func(name string) []string {
+		return []string{testdata + "test8.org", testdata + "test8.sig", testdata + "test8.update", filepath.Join(dir, name)}
+	}
+
+	cases := []struct {
+		name      string
+		args      []string
+		expStdout func(stdout []byte) bool
+	}{
+		{name: "Printed stats", args: append([]string{"delta"}, deltaArgs("text.delta")...),
+			expStdout: func(stdout []byte) bool {
+				return bytes.HasPrefix(stdout, []byte("updated bytes: 529\nmatched bytes: 512 (96.79%)\nliteral bytes: 17\nmatch records: 2\nliteral records: 3\nweak hash hits: 2 (0 false positives)\n"))
+			}},
+		{name: "JSON stats", args: append([]string{"delta", "--stats"}, deltaArgs("json.delta")...),
+			expStdout: func(stdout []byte) bool {
+				var info statsInfo
+				err := json.Unmarshal(stdout, &info)
+				return err == nil && info.UpdatedBytes == 529 && info.MatchedBytes == 512 && info.LiteralBytes == 17 &&
+					info.MatchRecords == 2 && info.LiteralRecords == 3 && info.WeakHashHits == 2 && info.DeltaBytes == 41
+			}},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(c.args, nil, &stdout, &stderr)
+			if code != EXIT_OK {
+				t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), EXIT_OK, code, stderr.String())
+			}
+			if !c.expStdout(stdout.Bytes()) {
+				t.Fatalf("'%s' Failed : unexpected stdout: %s", t.Name(), stdout.String())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestRunPipes(t *testing.T) {
+	dir := t.TempDir()
+	const testdata = "../../pkg/delta/testdata/"
+	original, err := os.ReadFile(testdata + "test5.org")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	updated, err := os.ReadFile(testdata + "test5.update")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+
+	// pipe returns the read end of a pipe fed with data, so its size is not known
+	pipe := func(data []byte) *os.File {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		go func() {
+			w.Write(data)
+			w.Close()
+		}()
+		t.Cleanup(func() { r.Close() })
+		return r
+	}
+
+	// the signature, the delta and the updated file go through stdin and stdout
+	var sig, deltaBuf, output, stderr bytes.Buffer
+	code := run([]string{"signature", "-", "-"}, pipe(original), &sig, &stderr)
+	if code != EXIT_OK {
+		t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), EXIT_OK, code, stderr.String())
+	}
+	code = run([]string{"delta", "--stats", testdata + "test5.org", "-", testdata + "test5.update", "-"}, pipe(sig.Bytes()), &deltaBuf, &stderr)
+	if code != EXIT_OK {
+		t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), EXIT_OK, code, stderr.String())
+	}
+	var info statsInfo
+	err = json.Unmarshal(stderr.Bytes(), &info)
+	if err != nil || info.UpdatedBytes != uint64(len(updated)) || info.DeltaBytes != uint64(deltaBuf.Len()) {
+		t.Fatalf("'%s' Failed : unexpected stats on stderr: %s", t.Name(), stderr.String())
+	}
+	code = run([]string{"patch", testdata + "test5.org", "-", "-"}, pipe(deltaBuf.Bytes()), &output, &stderr)
+	if code != EXIT_OK {
+		t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), EXIT_OK, code, stderr.String())
+	}
+	if !bytes.Equal(output.Bytes(), updated) {
+		t.Fatalf("'%s' Failed : updated contents do not match", t.Name())
+	}
+
+	cases := []struct {
+		name    string
+		args    []string
+		stdin   []byte
+		expCode int
+	}{
+		// Happy Paths
+		{name: "Updated file from stdin", args: []string{"delta", testdata + "test5.org", testdata + "test5.sig", "-", filepath.Join(dir, "test5.delta")}, stdin: updated, expCode: EXIT_OK},
+		{name: "Inspect from stdin", args: []string{"inspect", "-"}, stdin: sig.Bytes(), expCode: EXIT_OK},
+
+		// Unhappy Paths
+		{name: "Empty input from stdin", args: []string{"signature", "-", filepath.Join(dir, "empty.sig")}, stdin: nil, expCode: EXIT_EMPTY_INPUT_FILE},
+		{name: "Empty updated file from stdin", args: []string{"delta", testdata + "test5.org", testdata + "test5.sig", "-", "-"}, stdin: nil, expCode: EXIT_EMPTY_UPDATED_FILE},
+		{name: "Original file from stdin for delta", args: []string{"delta", "-", testdata + "test5.sig", testdata + "test5.update", "-"}, stdin: original, expCode: EXIT_USAGE},
+		{name: "Original file from stdin for patch", args: []string{"patch", "-", testdata + "test104.delta", "-"}, stdin: original, expCode: EXIT_USAGE},
+		{name: "Signature and updated file from stdin", args: []string{"delta", testdata + "test5.org", "-", "-", "-"}, stdin: sig.Bytes(), expCode: EXIT_USAGE},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(c.args, pipe(c.stdin), &stdout, &stderr)
+			if code != c.expCode {
+				t.Fatalf("'%s' Failed : expected exit code:%d, got:%d (%s)", t.Name(), c.expCode, code, stderr.String())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+// updateRdiff regenerates the librsync test vectors with rdiff: go test ./cmd/rollinghash -run TestRunRdiff -update-rdiff
+var updateRdiff = flag.Bool("update-rdiff", false, "write the librsync test vectors with rdiff instead of comparing them")
+
+// TestRunRdiff checks the librsync files against rdiff of librsync 2.3 or later, it is skipped when rdiff isn't installed
+// the command lines are listed in the README.md of the testdata directories
+func TestRunRdiff(t *testing.T) {
+	rdiff, err := exec.LookPath("rdiff")
+	if err != nil {
+		t.Skip("rdiff is not installed")
+	}
+	dir := t.TempDir()
+	out := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	const testdata = "../../pkg/delta/testdata/"
+	const sigTestdata = "../../pkg/signature/testdata/"
+
+	// the files written by rdiff must match the golden files of the librsync tests
+	// --sum-size is always set, rdiff 2.3 truncates the strong hashes by default
+	goldens := []struct {
+		name   string
+		args   []string
+		golden string
+	}{
+		{name: "rollsum and MD4", args: []string{"signature", "--block-size=2048", "--sum-size=16", "--hash=md4", "--rollsum=rollsum", sigTestdata + "test5.org"}, golden: sigTestdata + "test5.rdiff-md4.sig"},
+		{name: "rollsum and BLAKE2", args: []string{"signature", "--block-size=2048", "--sum-size=32", "--hash=blake2", "--rollsum=rollsum", sigTestdata + "test5.org"}, golden: sigTestdata + "test5.rdiff-blake2.sig"},
+		{name: "rabinkarp and MD4", args: []string{"signature", "--block-size=2048", "--sum-size=16", "--hash=md4", "--rollsum=rabinkarp", sigTestdata + "test5.org"}, golden: sigTestdata + "test5.rdiff-rk-md4.sig"},
+		{name: "rabinkarp and BLAKE2", args: []string{"signature", "--block-size=2048", "--sum-size=32", "--hash=blake2", "--rollsum=rabinkarp", sigTestdata + "test5.org"}, golden: sigTestdata + "test5.rdiff-rk-blake2.sig"},
+		{name: "Truncated BLAKE2", args: []string{"signature", "--block-size=256", "--sum-size=8", "--hash=blake2", "--rollsum=rollsum", sigTestdata + "test2.org"}, golden: sigTestdata + "test2.rdiff-blake2-8.sig"},
+		{name: "Two Chunk file", args: []string{"signature", "--block-size=256", "--sum-size=32", "--hash=blake2", "--rollsum=rollsum", testdata + "test8.org"}, golden: testdata + "test8.rdiff.sig"},
+		// the delta is patched by TestRun
+		{name: "Two Chunk delta", args: []string{"delta", testdata + "test8.rdiff.sig", testdata + "test8.update"}, golden: testdata + "test8.rdiff.delta"},
+	}
+
+	for _, c := range goldens {
+		tf := func(t *testing.T) {
+			outfile := out(filepath.Base(c.golden))
+			args := append(append([]string{}, c.args...), outfile)
+			output, err := exec.Command(rdiff, args...).CombinedOutput()
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v (%s)", t.Name(), err, output)
+			}
+			actual, err := os.ReadFile(outfile)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if *updateRdiff {
+				err = os.WriteFile(c.golden, actual, 0666)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(c.golden)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !bytes.Equal(actual, expected) {
+				t.Fatalf("'%s' Failed : %s of rdiff does not match %s", t.Name(), c.args[0], c.golden)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+
+	// the files written by rdiff are read by rollinghash and the other way around
+	original, updated := testdata+"test5.org", testdata+"test5.update"
+	steps := []struct {
+		name  string
+		rdiff bool
+		args  []string
+	}{
+		{name: "rollinghash signature", args: []string{"signature", "--format", "librsync", "--chunk-size", "1024", original, out("rh.sig")}},
+		{name: "rdiff delta", rdiff: true, args: []string{"delta", out("rh.sig"), updated, out("rdiff.delta")}},
+		{name: "rollinghash patch", args: []string{"patch", original, out("rdiff.delta"), out("rh.update")}},
+		{name: "rdiff signature", rdiff: true, args: []string{"signature", "--block-size=1024", "--hash=blake2", "--rollsum=rabinkarp", original, out("rdiff.sig")}},
+		{name: "rollinghash delta", args: []string{"delta", "--format", "librsync", original, out("rdiff.sig"), updated, out("rh.delta")}},
+		{name: "rdiff patch", rdiff: true, args: []string{"patch", original, out("rh.delta"), out("rdiff.update")}},
+	}
+
+	for _, step := range steps {
+		if step.rdiff {
+			output, err := exec.Command(rdiff, step.args...).CombinedOutput()
+			if err != nil {
+				t.Fatalf("'%s' Failed : %s with error: %v (%s)", t.Name(), step.name, err, output)
+			}
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		code := run(step.args, nil, &stdout, &stderr)
+		if code != EXIT_OK {
+			t.Fatalf("'%s' Failed : %s expected exit code:%d, got:%d (%s)", t.Name(), step.name, EXIT_OK, code, stderr.String())
+		}
+	}
+
+	expected, err := os.ReadFile(updated)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	for _, name := range []string{"rh.update", "rdiff.update"} {
+		output, err := os.ReadFile(out(name))
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		if !bytes.Equal(output, expected) {
+			t.Fatalf("'%s' Failed : %s does not match the updated file", t.Name(), name)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/spf13/cobra"
+)
+
+func getPatchCmd(flags *logFlags) *cobra.Command {
+	var force bool
+
+	patchCmd := &cobra.Command{
+		Use:   "patch",
+		Short: "Apply delta on original file to reconstruct updated file",
+		Args:  exactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := flags.logger(cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			return delta.ApplyDelta(args[0], args[1], args[2], &delta.Options{Overwrite: force, Stdin: cmd.InOrStdin(), Stdout: cmd.OutOrStdout(), Logger: logger})
+		},
+	}
+
+	patchCmd.Flags().BoolVarP(&force, "force", "f", false, "replace the output file if it exists")
+
+	patchCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		cmd.Println("Usage: rollinghash patch [--force] <original_file> <delta_file> <output_file>")
+		cmd.Println("delta_file and output_file can be \"-\" for stdin and stdout, original_file is read at random offsets and can't be \"-\"")
+		cmd.Println("delta_file can also be a librsync delta written by rdiff delta")
+		printGlobalFlags(cmd)
+		return nil
+	})
+
+	return patchCmd
+}
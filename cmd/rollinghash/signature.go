@@ -1,22 +1,102 @@
 package main
 
 import (
+	"fmt"
+
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
 	"github.com/SDkie/rollinghash/pkg/signature"
 	"github.com/spf13/cobra"
 )
 
-func getSignatureCmd() *cobra.Command {
+func getSignatureCmd(flags *logFlags) *cobra.Command {
+	var formatName, hashName, strongHashName, checksumName, heuristicName string
+	var chunkLen uint32
+	var cdc, mmap, force bool
+	var jobs, hashWidth int
+	var cdcOpts signature.CDCOptions
+
 	signatureCmd := &cobra.Command{
 		Use:   "signature",
 		Short: "Generate signature for input file",
-		Args:  cobra.ExactArgs(2),
-		Run: func(cmd *cobra.Command, args []string) {
-			signature.GenerateSignature(args[0], args[1])
+		Args:  exactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := flags.logger(cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			fileFormat, err := format.ParseType(formatName)
+			if err != nil {
+				return usageError{err}
+			}
+			// librsync signatures need a strong hash
+			if fileFormat == format.LIBRSYNC {
+				if !cmd.Flags().Changed("strong-hash") {
+					strongHashName = "blake2b"
+				}
+			}
+			hashType, err := rollinghash.ParseType(hashName)
+			if err != nil {
+				return usageError{err}
+			}
+			strongHash, err := signature.ParseStrongHashType(strongHashName)
+			if err != nil {
+				return usageError{err}
+			}
+			checksum, err := signature.ParseStrongHashType(checksumName)
+			if err != nil {
+				return usageError{err}
+			}
+			heuristic, err := signature.ParseChunkSizeHeuristic(heuristicName)
+			if err != nil {
+				return usageError{err}
+			}
+			if hashWidth != 32 && hashWidth != 64 {
+				return usageError{fmt.Errorf("invalid hash width: %d", hashWidth)}
+			}
+			// the other rolling hashes have 32 bits, their 64 bits hashes would only add zeros
+			if hashWidth == 64 && hashType != rollinghash.RABINKARP64 {
+				return usageError{fmt.Errorf("hash width 64 needs the rabinkarp64 hash, %s has 32 bits", hashType)}
+			}
+
+			jobs, err = getJobs(jobs)
+			if err != nil {
+				return err
+			}
+
+			opts := &signature.Options{Format: fileFormat, Hash: hashType, StrongHash: strongHash, Checksum: checksum, Hash64: hashWidth == 64, ChunkLen: chunkLen, ChunkSizeHeuristic: heuristic, Jobs: jobs, Mmap: mmap, Overwrite: force, Stdin: cmd.InOrStdin(), Stdout: cmd.OutOrStdout(), Logger: logger}
+			if cdc {
+				opts.CDC = &cdcOpts
+			}
+			cmd.SilenceUsage = true
+			_, err = signature.GenerateSignature(args[0], args[1], opts)
+			return err
 		},
 	}
+	signatureCmd.Flags().StringVar(&formatName, "format", "native", "format of the signature file (native, librsync), librsync signatures are read by rdiff and need fixed size chunks, the rabinkarp or rollsum hash and the blake2b or md4 strong hash")
+	signatureCmd.Flags().StringVar(&hashName, "hash", "rabinkarp", "rolling hash for each chunk (rabinkarp, rollsum, buzhash, gear, rabinkarp64), gear only hashes the last 64 bytes of each chunk so chunks with the same tail match falsely")
+	signatureCmd.Flags().IntVar(&hashWidth, "hash-width", 32, "bits stored for each chunk hash (32, 64), 64 needs the rabinkarp64 hash and fewer verifications of chunks on large files")
+	signatureCmd.Flags().StringVar(&strongHashName, "strong-hash", "none", "strong hash stored for each chunk (none, blake2b, sha256, xxh3, md4), blake2b with --format librsync")
+	signatureCmd.Flags().StringVar(&checksumName, "checksum", "none", "strong hash of the whole input file stored with its size and modification time, delta verifies the original file with it (none, blake2b, sha256, xxh3), none with --format librsync")
+
+	signatureCmd.Flags().Uint32Var(&chunkLen, "chunk-size", 0, fmt.Sprintf("length of fixed size chunks, between %d and %d, 0 picks it from the input size", signature.MinChunkLen, signature.MaxChunkLen))
+	signatureCmd.Flags().StringVar(&heuristicName, "chunk-size-heuristic", "sqrt", "chunk length picked from the input size without --chunk-size (sqrt, rsync, tiered)")
+
+	signatureCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of goroutines hashing the chunks, 0 uses all the CPUs (ignored with --cdc)")
+
+	signatureCmd.Flags().BoolVar(&mmap, "mmap", false, "memory map the input file, it is read when it can't be mapped")
+
+	signatureCmd.Flags().BoolVarP(&force, "force", "f", false, "replace the signature file if it exists")
+
+	signatureCmd.Flags().BoolVar(&cdc, "cdc", false, "split the input file in content defined chunks")
+	signatureCmd.Flags().Uint32Var(&cdcOpts.MinChunkLen, "cdc-min", signature.DefaultMinChunkLen, "minimum length of content defined chunks")
+	signatureCmd.Flags().Uint32Var(&cdcOpts.AvgChunkLen, "cdc-avg", signature.DefaultAvgChunkLen, "average length of content defined chunks, a power of two")
+	signatureCmd.Flags().Uint32Var(&cdcOpts.MaxChunkLen, "cdc-max", signature.DefaultMaxChunkLen, "maximum length of content defined chunks")
 
 	signatureCmd.SetUsageFunc(func(cmd *cobra.Command) error {
-		cmd.Println("Usage: rollinghash signature <input_file> <signature_file>")
+		cmd.Println("Usage: rollinghash signature [--format native|librsync] [--hash rabinkarp|rollsum|buzhash|gear|rabinkarp64] [--hash-width 32|64] [--strong-hash none|blake2b|sha256|xxh3|md4] [--checksum none|blake2b|sha256|xxh3] [--chunk-size n | --chunk-size-heuristic sqrt|rsync|tiered] [--jobs n] [--mmap] [--force] [--cdc [--cdc-min n] [--cdc-avg n] [--cdc-max n]] <input_file> <signature_file>")
+		cmd.Println("input_file and signature_file can be \"-\" for stdin and stdout")
+		printGlobalFlags(cmd)
 		return nil
 	})
 
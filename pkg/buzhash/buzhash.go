@@ -0,0 +1,73 @@
+package buzhash
+
+import "math/bits"
+
+// Buzhash is the cyclic polynomial rolling hash of a window of bytes.
+//
+// The hash of the window b[0..n) is T[b[0]]<<<(n-1) ^ T[b[1]]<<<(n-2) ^ ... ^ T[b[n-1]]
+// where <<< is rotate left and T is a fixed table of random values.
+// It implements rollinghash.RollingHash.
+type Buzhash struct {
+	hash uint64
+	n    uint
+}
+
+// The Buzhash table seed.
+//
+// The table is generated from this seed, changing it changes all the hashes.
+const BUZHASH_SEED uint64 = 0x62757a68617368
+
+var table = newTable(BUZHASH_SEED)
+
+// newTable generates the byte table with splitmix64
+func newTable(seed uint64) [256]uint64 {
+	var t [256]uint64
+	for i := range t {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}
+
+// New returns a Buzhash for an empty window
+func New() *Buzhash {
+	return &Buzhash{}
+}
+
+// Reset empties the window
+func (b *Buzhash) Reset() {
+	b.hash, b.n = 0, 0
+}
+
+// Write appends p to the window
+func (b *Buzhash) Write(p []byte) (int, error) {
+	for _, c := range p {
+		b.hash = bits.RotateLeft64(b.hash, 1) ^ table[c]
+	}
+	b.n += uint(len(p))
+	return len(p), nil
+}
+
+// Roll removes out from the start of the window and appends in to the end
+func (b *Buzhash) Roll(out, in byte) {
+	b.hash = bits.RotateLeft64(b.hash, 1) ^ bits.RotateLeft64(table[out], int(b.n%64)) ^ table[in]
+}
+
+// RollOut removes out from the start of the window
+func (b *Buzhash) RollOut(out byte) {
+	b.hash ^= bits.RotateLeft64(table[out], int((b.n-1)%64))
+	b.n--
+}
+
+// Sum32 returns the hash of the window folded to 32 bits
+func (b *Buzhash) Sum32() uint32 {
+	return uint32(b.hash ^ b.hash>>32)
+}
+
+// Sum64 returns the hash of the window
+func (b *Buzhash) Sum64() uint64 {
+	return b.hash
+}
@@ -0,0 +1,311 @@
+package delta
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+
+	"github.com/SDkie/rollinghash/pkg/util"
+)
+
+var (
+	ErrInvalidDeltaFile = errors.New("invalid delta file")
+	ErrChunkLenMismatch = errors.New("delta chunk length does not match originalFile")
+	ErrOriginalMismatch = errors.New("originalFile does not match the checksum of the delta")
+	ErrUpdatedMismatch  = errors.New("updated file does not match the checksum of the delta")
+)
+
+// patch struct contains all the data required to apply a delta file
+type patch struct {
+	chunkLen uint32
+
+	// originalSize is -1 when the size of the original file is unknown
+	originalSize int64
+	original     io.ReaderAt
+	delta        *Reader
+	outputFile   *bufio.Writer
+	// updatedDigest is the digest of the output, only with FLAG_CHECKSUM
+	updatedDigest *digest
+
+	log *slog.Logger
+}
+
+// newPatch creates a new patch struct
+// it reads the header of the delta file
+func newPatch(w io.Writer, basis io.ReaderAt, delta io.Reader, opts *Options) (*patch, error) {
+	var p patch
+	p.log = opts.logger()
+	p.original = basis
+	p.outputFile = bufio.NewWriter(w)
+
+	p.originalSize = -1
+	size, ok := util.Size(basis)
+	if ok {
+		p.originalSize = size
+	}
+
+	// the chunk length is chosen when generating the signature, MATCH records are checked against the original size
+	var err error
+	p.delta, err = NewReader(delta, opts)
+	if err != nil {
+		return nil, err
+	}
+	header := p.delta.Header()
+	p.chunkLen = header.ChunkLen
+
+	if header.Flags&FLAG_ORIGINAL_CHECKSUM != 0 && basis != nil {
+		err = p.verifyOriginal(header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if header.Flags&FLAG_CHECKSUM != 0 {
+		p.updatedDigest = newDigest(header.Checksum)
+		p.outputFile = bufio.NewWriter(io.MultiWriter(w, p.updatedDigest))
+	}
+
+	return &p, nil
+}
+
+// verifyOriginal checks that basis is the original file of the delta, before anything is written
+func (p *patch) verifyOriginal(header Header) error {
+	if p.originalSize >= 0 && uint64(p.originalSize) != header.OriginalSize {
+		err := ErrOriginalMismatch
+		p.log.Error(err.Error(), "size", p.originalSize, "expected", header.OriginalSize)
+		return err
+	}
+
+	d, err := readDigest(header.Checksum, p.original)
+	if err != nil {
+		p.log.Error("error reading originalFile", "err", err)
+		return err
+	}
+	if d.size != header.OriginalSize || string(d.sum()) != string(header.OriginalDigest) {
+		err := ErrOriginalMismatch
+		p.log.Error(err.Error(), "size", d.size, "expected", header.OriginalSize)
+		return err
+	}
+	return nil
+}
+
+// verifyUpdated checks the output against the CHECKSUM record r
+func (p *patch) verifyUpdated(r Record) error {
+	err := p.outputFile.Flush()
+	if err != nil {
+		p.log.Error("error writing to outputFile", "err", err)
+		return err
+	}
+	if p.updatedDigest.size != r.Len || string(p.updatedDigest.sum()) != string(r.Digest) {
+		err := ErrUpdatedMismatch
+		p.log.Error(err.Error(), "size", p.updatedDigest.size, "expected", r.Len)
+		return err
+	}
+	return nil
+}
+
+// ApplyDelta applies the delta file on the original file and writes the updated file to outputFileName
+// The file name "-" reads the delta file from stdin and writes the updated file to stdout.
+// The updated file is written to a temporary file renamed to outputFileName on success,
+// so a failure leaves no partial updated file.
+// Only the Overwrite, Stdin, Stdout and Logger of opts are used.
+func ApplyDelta(originalFileName, deltaFileName, outputFileName string, opts *Options) error {
+	logger := opts.logger()
+	err := checkStdin(originalFileName, []string{deltaFileName}, logger)
+	if err != nil {
+		return err
+	}
+
+	// Original file
+	originalFile, err := os.Open(originalFileName)
+	if err != nil {
+		logger.Error("error opening originalFile", "err", err)
+		return err
+	}
+	defer originalFile.Close()
+	stats, err := originalFile.Stat()
+	if err != nil {
+		logger.Error("error getting originalFile stats", "err", err)
+		return err
+	}
+	if util.IsEmpty(stats) {
+		err := ErrEmptyOriginalFile
+		logger.Error(err.Error())
+		return err
+	}
+
+	// Delta file
+	deltaFile := opts.stdin()
+	if deltaFileName != util.StdioName {
+		f, err := os.Open(deltaFileName)
+		if err != nil {
+			logger.Error("error opening deltaFile", "err", err)
+			return err
+		}
+		defer f.Close()
+		deltaFile = f
+	}
+
+	// Output file
+	outputFile := opts.stdout()
+	var atomicFile *util.AtomicFile
+	if outputFileName != util.StdioName {
+		f, err := util.CreateAtomic(outputFileName, opts != nil && opts.Overwrite)
+		if err != nil {
+			logger.Error("error creating outputFile", "err", err)
+			return err
+		}
+		defer f.Close()
+		outputFile, atomicFile = f, f
+	}
+
+	err = Apply(outputFile, originalFile, deltaFile, opts)
+	if err != nil {
+		return err
+	}
+	if atomicFile != nil {
+		err = atomicFile.Commit()
+		if err != nil {
+			logger.Error("error writing to outputFile", "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply applies the delta read from delta on basis and writes the updated file to w
+// The MATCH records of the delta are validated against basis when its size is known.
+// A delta with checksums is only applied on its original file, which is read once more to hash it,
+// and the output is verified, what was written to w must be discarded when ErrUpdatedMismatch is returned.
+// Only the Logger of opts is used.
+func Apply(w io.Writer, basis io.ReaderAt, delta io.Reader, opts *Options) error {
+	p, err := newPatch(w, basis, delta, opts)
+	if err != nil {
+		return err
+	}
+
+	for {
+		err = p.applyRecord()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+
+	err = p.outputFile.Flush()
+	if err != nil {
+		p.log.Error("error writing to outputFile", "err", err)
+		return err
+	}
+	return nil
+}
+
+// applyRecord reads the next record from the delta file and applies it
+// it returns io.EOF when there are no more records
+func (p *patch) applyRecord() error {
+	r, err := p.delta.Next()
+	if err != nil {
+		return err
+	}
+
+	switch r.Cmd {
+	case MATCH:
+		return p.copyChunks(r.StartChunkIndex, r.EndChunkIndex)
+	case LITERAL:
+		return p.copyLiterals(r.Len)
+	case CHECKSUM:
+		return p.verifyUpdated(r)
+	default:
+		return p.copyRange(r.Offset, r.Len)
+	}
+}
+
+// copyChunks copies the chunks from startChunkIndex to endChunkIndex of the original file to the output file
+func (p *patch) copyChunks(startChunkIndex, endChunkIndex uint64) error {
+	if p.original == nil {
+		err := ErrMissingOriginalFile
+		p.log.Error(err.Error())
+		return err
+	}
+
+	maxChunks := uint64(math.MaxInt64) / uint64(p.chunkLen)
+	if p.originalSize >= 0 {
+		maxChunks = uint64(p.originalSize+int64(p.chunkLen)-1) / uint64(p.chunkLen)
+	}
+	// chunks after the end of the original file come from a delta of another file or chunk length
+	if endChunkIndex >= maxChunks {
+		err := ErrInvalidDeltaFile
+		if p.originalSize >= 0 {
+			err = ErrChunkLenMismatch
+		}
+		p.log.Error(err.Error(), "startChunkIndex", startChunkIndex, "endChunkIndex", endChunkIndex)
+		return err
+	}
+	start := int64(startChunkIndex) * int64(p.chunkLen)
+	end := (int64(endChunkIndex) + 1) * int64(p.chunkLen)
+	if p.originalSize >= 0 && end > p.originalSize {
+		end = p.originalSize
+	}
+
+	n, err := io.Copy(p.outputFile, io.NewSectionReader(p.original, start, end-start))
+	if err != nil {
+		p.log.Error("error writing to outputFile", "err", err)
+		return err
+	}
+	// with unknown original size, a range starting after the end of the original file copies nothing
+	if n == 0 {
+		err := ErrInvalidDeltaFile
+		p.log.Error(err.Error(), "startChunkIndex", startChunkIndex, "endChunkIndex", endChunkIndex)
+		return err
+	}
+	return nil
+}
+
+// copyRange copies size bytes at offset of the original file to the output file
+func (p *patch) copyRange(offset, size uint64) error {
+	if p.original == nil {
+		err := ErrMissingOriginalFile
+		p.log.Error(err.Error())
+		return err
+	}
+
+	maxSize := uint64(math.MaxInt64)
+	if p.originalSize >= 0 {
+		maxSize = uint64(p.originalSize)
+	}
+	if offset > maxSize || size > maxSize-offset {
+		err := ErrInvalidDeltaFile
+		p.log.Error(err.Error(), "offset", offset, "size", size)
+		return err
+	}
+
+	n, err := io.Copy(p.outputFile, io.NewSectionReader(p.original, int64(offset), int64(size)))
+	if err != nil {
+		p.log.Error("error writing to outputFile", "err", err)
+		return err
+	}
+	// with unknown original size, the range can end after the end of the original file
+	if n != int64(size) {
+		err := ErrInvalidDeltaFile
+		p.log.Error(err.Error(), "offset", offset, "size", size)
+		return err
+	}
+	return nil
+}
+
+// copyLiterals copies size literal bytes from the delta file to the output file
+func (p *patch) copyLiterals(size uint64) error {
+	_, err := io.CopyN(p.outputFile, p.delta.Literals(), int64(size))
+	if err != nil {
+		if err == io.EOF {
+			err = ErrInvalidDeltaFile
+		}
+		p.log.Error("error copying literals to outputFile", "err", err)
+		return err
+	}
+	return nil
+}
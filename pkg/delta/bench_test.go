@@ -0,0 +1,61 @@
+package delta_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+var benchSize = flag.Int("bench.size", 1<<30, "size of the original and updated files of the benchmarks")
+
+// BenchmarkGenerate measures the throughput of the delta scanner on the updated file
+// run with -bench.size to use smaller inputs than 1 GiB
+func BenchmarkGenerate(b *testing.B) {
+	original := make([]byte, *benchSize)
+	rand.New(rand.NewSource(1)).Read(original)
+
+	// mostly similar: 16 bytes are changed every MiB
+	similar := append([]byte(nil), original...)
+	for offset := 0; offset < len(similar); offset += 1 << 20 {
+		copy(similar[offset:], "16 changed bytes")
+	}
+	random := make([]byte, *benchSize)
+	rand.New(rand.NewSource(2)).Read(random)
+
+	var sigBuf bytes.Buffer
+	sig, err := signature.Write(&sigBuf, bytes.NewReader(original), nil)
+	if err != nil {
+		b.Fatalf("'%s' Failed with error: %v", b.Name(), err)
+	}
+
+	cases := []struct {
+		name    string
+		updated []byte
+		jobs    int
+	}{
+		{name: "random", updated: random},
+		{name: "similar", updated: similar},
+		{name: "random with 4 jobs", updated: random, jobs: 4},
+		{name: "similar with 4 jobs", updated: similar, jobs: 4},
+	}
+
+	for _, c := range cases {
+		bf := func(b *testing.B) {
+			b.SetBytes(int64(len(c.updated)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := delta.Generate(io.Discard, sig, bytes.NewReader(original), bytes.NewReader(c.updated), &delta.Options{Jobs: c.jobs})
+				if err != nil {
+					b.Fatalf("'%s' Failed with error: %v", b.Name(), err)
+				}
+			}
+		}
+
+		b.Run(c.name, bf)
+	}
+}
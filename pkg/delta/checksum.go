@@ -0,0 +1,132 @@
+package delta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math"
+
+	"github.com/SDkie/rollinghash/pkg/signature"
+	"github.com/SDkie/rollinghash/pkg/util"
+)
+
+// digest is the strong hash and the size of a whole file written in parts
+type digest struct {
+	h    hash.Hash
+	size uint64
+}
+
+// newDigest returns an empty digest with the strong hash t
+func newDigest(t signature.StrongHashType) *digest {
+	return &digest{h: t.New()}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.size += uint64(len(p))
+	return d.h.Write(p)
+}
+
+// sum returns the strong hash of the bytes written
+func (d *digest) sum() []byte {
+	return d.h.Sum(nil)
+}
+
+// readDigest returns the digest of the whole file r
+func readDigest(t signature.StrongHashType, r io.ReaderAt) (*digest, error) {
+	d := newDigest(t)
+	_, err := io.Copy(d, io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// verifySignature checks that the original file is the input file of the signature with FLAG_CHECKSUM
+// A different size or strong hash returns ErrSignatureMismatch, or is only logged with ignoreMismatch.
+// A different modification time alone is logged, the original file was touched but not changed.
+func (d *delta) verifySignature(sig *signature.Signature, basis io.ReaderAt, ignoreMismatch bool) error {
+	mismatch := func(field string) error {
+		err := ErrSignatureMismatch
+		if ignoreMismatch {
+			d.log.Warn(err.Error(), "field", field)
+			return nil
+		}
+		d.log.Error(err.Error(), "field", field)
+		return err
+	}
+
+	if size, ok := util.Size(basis); ok && uint64(size) != sig.Size {
+		return mismatch("size")
+	}
+
+	// the checksum of the delta is reused when it has the same strong hash
+	originalDigest := d.originalDigest
+	if originalDigest == nil || d.checksum != sig.Checksum {
+		var err error
+		originalDigest, err = readDigest(sig.Checksum, basis)
+		if err != nil {
+			d.log.Error("error reading originalFile", "err", err)
+			return err
+		}
+	}
+	if originalDigest.size != sig.Size {
+		return mismatch("size")
+	}
+	if !bytes.Equal(originalDigest.sum(), sig.Digest) {
+		return mismatch("checksum")
+	}
+
+	if modTime, ok := util.ModTime(basis); ok && !sig.ModTime.IsZero() && !modTime.Equal(sig.ModTime) {
+		d.log.Warn("originalFile was modified since the signature, its content is unchanged", "modTime", modTime, "signatureModTime", sig.ModTime)
+	}
+	return nil
+}
+
+// writeChecksumHeader writes the checksum fields of the header after the chunk length
+func (d *delta) writeChecksumHeader() error {
+	if d.flags&FLAG_CHECKSUM == 0 {
+		return nil
+	}
+	data := []byte{byte(d.checksum)}
+	if d.flags&FLAG_ORIGINAL_CHECKSUM != 0 {
+		data = binary.AppendUvarint(data, d.originalDigest.size)
+		data = append(data, d.originalDigest.sum()...)
+	}
+	_, err := d.deltaFile.Write(data)
+	return err
+}
+
+// digestUpdated starts the digest of the updated file
+// the updated file is hashed while it is searched, unless it is searched by segments or mapped in memory
+func (d *delta) digestUpdated(updatedAt io.ReaderAt, readAt bool) error {
+	if !readAt {
+		d.updatedDigest = newDigest(d.checksum)
+		d.updated = io.TeeReader(d.updated, d.updatedDigest)
+		return nil
+	}
+
+	var err error
+	d.updatedDigest, err = readDigest(d.checksum, updatedAt)
+	if err != nil {
+		d.log.Error("error reading updatedFile", "err", err)
+		return err
+	}
+	return nil
+}
+
+// writeChecksum writes the CHECKSUM record of the updated file at the end of the delta file
+func (d *delta) writeChecksum() error {
+	if d.flags&FLAG_CHECKSUM == 0 {
+		return nil
+	}
+	data := []byte{byte(CHECKSUM)}
+	data = binary.AppendUvarint(data, d.updatedDigest.size)
+	data = append(data, d.updatedDigest.sum()...)
+	_, err := d.deltaFile.Write(data)
+	if err != nil {
+		d.log.Error("error writing to delta file", "err", err)
+		return err
+	}
+	return nil
+}
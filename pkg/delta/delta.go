@@ -1,149 +1,596 @@
 package delta
 
 import (
-	"encoding/hex"
+	"bufio"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
-	"github.com/SDkie/rollinghash/pkg/rabinkarp"
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
 	"github.com/SDkie/rollinghash/pkg/signature"
 	"github.com/SDkie/rollinghash/pkg/util"
 )
 
 var (
-	ErrEmptyOriginalFile = errors.New("originalFile is empty")
-	ErrEmptyUpdatedFile  = errors.New("updatedFile is empty")
+	ErrEmptyOriginalFile   = errors.New("originalFile is empty")
+	ErrEmptyUpdatedFile    = errors.New("updatedFile is empty")
+	ErrMissingOriginalFile = errors.New("originalFile is required for signature without strong hash")
+	ErrHashTypeMismatch    = errors.New("hash type does not match the signature")
+	ErrSignatureMismatch   = errors.New("originalFile does not match the checksum of the signature")
+	ErrStdinOriginalFile   = errors.New("originalFile can't be read from stdin, it is read at random offsets")
+	ErrStdinReadTwice      = errors.New("stdin can only be read for one file")
 )
 
 // Delta File Format:
-// 4 bytes - chunk length
-// 4 bytes - cmd with chunk index or literal with size
+// 4 bytes - magic "RHDL"
+// 2 bytes - format version
+// 2 bytes - flags
+// 4 bytes - chunk length (zero for deltas of content defined chunks)
+// only with FLAG_CHECKSUM:
+//	    1 byte    - strong hash of the checksums
+// only with FLAG_ORIGINAL_CHECKSUM:
+//	    uvarint   - size of the original file
+//	    N bytes   - strong hash of the original file
+// followed by the records, each starting with 1 byte cmd
 // if chunk match:
-// 	    '00'      - cmd
-//      'XXX'     - start chunk index
+//	    0x00      - cmd
+//	    uvarint   - start chunk index
+//	    uvarint   - end chunk index
+// if literal:
+//	    0x01      - cmd
+//	    uvarint   - literal size
+// if copy (only with FLAG_COPY):
+//	    0x02      - cmd
+//	    uvarint   - offset in the original file
+//	    uvarint   - length
+// if checksum (only with FLAG_CHECKSUM, the last record):
+//	    0x03      - cmd
+//	    uvarint   - size of the updated file
+//	    N bytes   - strong hash of the updated file
+// in case of literal after the cmd and size, literal data is written
+//
+// librsync delta files are also read and written, see librsync.go.
+//
+// Legacy (version 0) delta files have no magic, version and flags,
+// they start with the 4 bytes chunk length followed by 4 bytes records:
+// if chunk match:
+//	    '00'      - cmd
+//	    'XXX'     - start chunk index
 //	    'XXX'     - end chunk index
 // if literal:
 //	    '01'      - cmd (1 byte)
-//      'XXXXXX'  - literal size (3 bytes)
-// in case of literal after the cmd and size, literal data is written
+//	    'XXXXXX'  - literal size (3 bytes)
 
 // CmdType is used for creating delta file
-// 00 in the delta file means match
-// 01 in the delta file means miss (literal)
+// 0x00 in the delta file means match
+// 0x01 in the delta file means miss (literal)
+// 0x02 in the delta file means a copy of a byte range of the original file
+// 0x03 in the delta file means the checksum of the updated file
 type CmdType int
 
 const (
 	NO_CMD CmdType = iota - 1
 	MATCH
 	LITERAL
+	COPY
+	CHECKSUM
+)
+
+var cmdNames = map[CmdType]string{
+	NO_CMD:   "NO_CMD",
+	MATCH:    "MATCH",
+	LITERAL:  "LITERAL",
+	COPY:     "COPY",
+	CHECKSUM: "CHECKSUM",
+}
+
+func (c CmdType) String() string {
+	name, ok := cmdNames[c]
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", int(c))
+	}
+	return name
+}
+
+// Delta file flags
+// FLAG_COPY is set for deltas of content defined chunks, which use COPY records instead of MATCH records
+// FLAG_CHECKSUM is set for deltas ending with the CHECKSUM record of the updated file
+// FLAG_ORIGINAL_CHECKSUM is set for deltas recording the checksum of the original file in the header
+const (
+	FLAG_COPY uint16 = 1 << iota
+	FLAG_CHECKSUM
+	FLAG_ORIGINAL_CHECKSUM
+
+	knownFlags = FLAG_COPY | FLAG_CHECKSUM | FLAG_ORIGINAL_CHECKSUM
+)
+
+// MaxLiteralLen is the maximum size of literal data written in a single literal record
+// longer literal runs are split into several records, so the literals buffer stays bounded
+const MaxLiteralLen = 1 << 20
+
+// Delta file format versions
+const (
+	DeltaVersionLegacy uint16 = iota
+	DeltaVersion1
+
+	DeltaVersionLatest = DeltaVersion1
 )
 
+// Options contains the options for generating and applying a delta
+// nil Options uses the default options
+type Options struct {
+	// Format LIBRSYNC writes a librsync delta, which can be applied by rdiff, it can't record a Checksum.
+	// It is not used by Apply, which reads both formats.
+	Format format.Type
+	// HashType is the rolling hash used with legacy signatures, which don't record it.
+	// Signatures recording another hash type are rejected.
+	// nil uses the hash type recorded in the signature.
+	HashType *rollinghash.Type
+	// Jobs is the number of goroutines searching segments of the updated file, below 2 it is searched sequentially.
+	// Segments are only searched concurrently for fixed size chunks, when the updated file size is known
+	// and the updated file is an io.ReaderAt. Chunks crossing a segment edge are still found,
+	// but the delta can be slightly larger than the sequential one.
+	Jobs int
+	// Mmap memory maps the original and updated files in GenerateDelta,
+	// files which can't be mapped are read instead
+	Mmap bool
+	// Checksum is the strong hash of the whole original and updated files recorded in the delta,
+	// so the delta is only applied on its original file and the updated file is verified.
+	// The original file is read once more to hash it. STRONG_HASH_NONE records no checksum.
+	Checksum signature.StrongHashType
+	// IgnoreSignatureMismatch logs a warning instead of returning ErrSignatureMismatch
+	// when the original file doesn't match the checksum of the signature
+	IgnoreSignatureMismatch bool
+	// Overwrite replaces an existing output file in GenerateDelta and ApplyDelta
+	Overwrite bool
+	// Stdin is read for the file name "-" in GenerateDelta and ApplyDelta, nil reads os.Stdin
+	Stdin io.Reader
+	// Stdout receives the output file name "-" in GenerateDelta and ApplyDelta, nil writes to os.Stdout
+	Stdout io.Writer
+	// Logger receives the logs, nil logs nothing
+	Logger *slog.Logger
+}
+
+// logger returns the logger of the options
+func (o *Options) logger() *slog.Logger {
+	if o == nil {
+		return util.Logger(nil)
+	}
+	return util.Logger(o.Logger)
+}
+
+// stdin returns the reader of the file name "-"
+func (o *Options) stdin() io.Reader {
+	if o == nil {
+		return util.Stdin(nil)
+	}
+	return util.Stdin(o.Stdin)
+}
+
+// stdout returns the writer of the file name "-"
+func (o *Options) stdout() io.Writer {
+	if o == nil {
+		return util.Stdout(nil)
+	}
+	return util.Stdout(o.Stdout)
+}
+
 // Delta struct contains all the data required to generate delta file
 type delta struct {
-	chunkLen uint32
-	hashmap  map[uint32]uint32
+	chunkLen     uint32
+	flags        uint16
+	hashmap      map[uint64][]uint32
+	strongHash   signature.StrongHashType
+	strongHashes [][]byte
 
+	// hash64 is set for signatures with 64 bits hashes, otherwise the hashmap keys are 32 bits hashes
+	hash64 bool
+
+	// format is the format of the delta file
+	format format.Type
+
+	// checksum is the strong hash of the digests of the original and updated files, with FLAG_CHECKSUM
+	checksum       signature.StrongHashType
+	originalDigest *digest
+	updatedDigest  *digest
+
+	// chunkOffsets and chunkLens are set for signatures of content defined chunks
+	chunkOffsets []int64
+	chunkLens    []uint32
+
+	// matchCmd is the command written for matched chunks, MATCH or COPY
+	matchCmd        CmdType
 	currCmd         CmdType
 	startChunkIndex uint32
 	endChunkIndex   uint32
 	literals        []byte
 
-	currChunk []byte
-	hash      uint32
-	pow       uint32
+	// matchLen is the length of the current MATCH in the updated file
+	matchLen int64
 
-	originalFile *os.File
-	updatedFile  *os.File
-	deltaFile    *os.File
+	// currChunk is the content of the window, it is only valid until the window changes
+	currChunk []byte
+	window    *window
+	// oldChunk is the buffer for reading chunks of oldFile
+	oldChunk []byte
+	hashType rollinghash.Type
+	hash     rollinghash.RollingHash
+
+	// segment is set when the records are collected instead of being written to the delta file
+	segment bool
+	records []record
+
+	original io.ReaderAt
+	updated  io.Reader
+	// originalData and updatedData are set when the files are memory mapped
+	originalData []byte
+	updatedData  []byte
+	deltaFile    *bufio.Writer
+	// output counts the bytes written to the delta file
+	output *countingWriter
+
+	stats Stats
+
+	log *slog.Logger
+	// debug is set when debug logs are enabled, they are logged for every byte
+	debug bool
 }
 
 // newDelta create a new Delta struct
-// it opens all the provided files
-// also reads the signature file and insert all the hashes in a hashmap
-func newDelta(originalFile, sigFile, updatedFile, deltaFile string) (*delta, error) {
+// it inserts all the hashes of the signature in a hashmap,
+// chunks sharing a hash keep all their indexes in ascending order
+func newDelta(w io.Writer, sig *signature.Signature, basis io.ReaderAt, updated io.Reader, opts *Options) (*delta, error) {
 	var d delta
-	// Signature file
-	sig, err := signature.ReadSignature(sigFile)
+	d.log = opts.logger()
+	d.debug = d.log.Enabled(context.Background(), slog.LevelDebug)
+	err := checkOriginal(sig, basis != nil, d.log)
 	if err != nil {
 		return nil, err
 	}
+	hashType, err := getHashType(sig, opts, d.log)
+	if err != nil {
+		return nil, err
+	}
+	d.hashType = hashType
+	d.hash, err = rollinghash.New(hashType)
+	if err != nil {
+		d.log.Error(err.Error())
+		return nil, err
+	}
+
 	d.chunkLen = sig.ChunkLen
-	d.hashmap = make(map[uint32]uint32)
+	d.matchCmd = MATCH
+	if sig.Flags&signature.FLAG_VARIABLE_CHUNKS != 0 {
+		d.chunkLen = 0
+		d.flags = FLAG_COPY
+		d.matchCmd = COPY
+		d.chunkLens = sig.ChunkLens
+		d.chunkOffsets = make([]int64, len(sig.ChunkLens))
+		offset := int64(0)
+		for i, chunkLen := range sig.ChunkLens {
+			d.chunkOffsets[i] = offset
+			offset += int64(chunkLen)
+		}
+	}
+	d.hash64 = sig.Flags&signature.FLAG_HASH64 != 0
+	d.hashmap = make(map[uint64][]uint32)
 	for i := uint32(0); i < sig.TotalChunks; i++ {
-		d.hashmap[sig.Hashes[i]] = i
+		var hash uint64
+		if d.hash64 {
+			hash = sig.Hashes64[i]
+		} else {
+			hash = uint64(sig.Hashes[i])
+		}
+		d.hashmap[hash] = append(d.hashmap[hash], i)
 	}
-
-	//  Old file
-	d.originalFile, err = os.Open(originalFile)
+	d.strongHash = sig.StrongHash
+	d.strongHashes = sig.StrongHashes
+
+	if opts != nil && opts.Checksum != signature.STRONG_HASH_NONE {
+		if opts.Checksum.Size() == 0 {
+			err := signature.ErrUnknownStrongHash
+			d.log.Error(err.Error(), "checksum", opts.Checksum)
+			return nil, err
+		}
+		d.checksum = opts.Checksum
+		d.flags |= FLAG_CHECKSUM
+		if basis != nil {
+			d.flags |= FLAG_ORIGINAL_CHECKSUM
+			d.originalDigest, err = readDigest(d.checksum, basis)
+			if err != nil {
+				d.log.Error("error reading originalFile", "err", err)
+				return nil, err
+			}
+		}
+	}
+	err = d.setFormat(opts)
 	if err != nil {
-		log.Printf("error opening originalFile: %s", err)
 		return nil, err
 	}
-	stats, err := d.originalFile.Stat()
+	if basis != nil && sig.Flags&signature.FLAG_CHECKSUM != 0 {
+		err = d.verifySignature(sig, basis, opts != nil && opts.IgnoreSignatureMismatch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.original = basis
+	d.updated = updated
+	if m, ok := basis.(*util.MappedFile); ok {
+		d.originalData = m.Bytes()
+	}
+	if m, ok := updated.(*util.MappedFile); ok && m.Len() == len(m.Bytes()) {
+		d.updatedData = m.Bytes()
+	}
+	d.output = &countingWriter{w: w}
+	d.deltaFile = bufio.NewWriter(d.output)
+
+	d.currCmd = NO_CMD
+
+	err = d.writeHeader()
 	if err != nil {
-		log.Printf("error getting originalFile stats: %s", err)
 		return nil, err
 	}
-	if stats.Size() == 0 {
-		err := ErrEmptyOriginalFile
-		log.Println(err)
+
+	return &d, nil
+}
+
+// checkOriginal checks that the original file is present when the signature needs it
+// the original file is optional when the signature contains strong hashes
+func checkOriginal(sig *signature.Signature, hasOriginal bool, logger *slog.Logger) error {
+	if !hasOriginal && sig.StrongHash == signature.STRONG_HASH_NONE {
+		err := ErrMissingOriginalFile
+		logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// getHashType returns the rolling hash type to use with the signature
+// legacy signatures don't record it, so opts.HashType is used for them
+func getHashType(sig *signature.Signature, opts *Options, logger *slog.Logger) (rollinghash.Type, error) {
+	if opts == nil || opts.HashType == nil {
+		return sig.HashType, nil
+	}
+	if sig.Version == signature.SignatureVersionLegacy && sig.Format == format.NATIVE {
+		return *opts.HashType, nil
+	}
+	if *opts.HashType != sig.HashType {
+		err := ErrHashTypeMismatch
+		logger.Error(err.Error(), "expected", *opts.HashType, "signature", sig.HashType)
+		return 0, err
+	}
+	return sig.HashType, nil
+}
+
+// GenerateDelta generates the delta file
+// signature and original file both are required for genearing delta,
+// as just matching of hash can't guarantee matching of the chunks.
+// If the signature contains strong hashes, matches are verified against them
+// and oldFileName can be empty.
+// The file name "-" reads the signature or the updated file from stdin and writes the delta to stdout.
+// The delta file is written to a temporary file renamed to deltaFileName on success,
+// so a failure leaves no partial delta file.
+// It returns the statistics of the generated delta.
+func GenerateDelta(oldFileName, sigFileName, newFileName, deltaFileName string, opts *Options) (*Stats, error) {
+	start := time.Now()
+	logger := opts.logger()
+	err := checkStdin(oldFileName, []string{sigFileName, newFileName}, logger)
+	if err != nil {
 		return nil, err
 	}
 
-	// New file
-	d.updatedFile, err = os.Open(updatedFile)
+	// Signature file
+	sig, err := signature.ReadSignature(sigFileName, &signature.Options{Stdin: opts.stdin(), Logger: logger})
 	if err != nil {
-		log.Printf("error opening updatedFile: %s", err)
 		return nil, err
 	}
-	stats, err = d.updatedFile.Stat()
+	err = checkOriginal(sig, oldFileName != "", logger)
 	if err != nil {
-		log.Printf("error getting updatedFile stats: %s", err)
 		return nil, err
 	}
-	if stats.Size() == 0 {
-		err := ErrEmptyUpdatedFile
-		log.Println(err)
+	_, err = getHashType(sig, opts, logger)
+	if err != nil {
 		return nil, err
 	}
 
+	//  Old file
+	var basis io.ReaderAt
+	if oldFileName != "" {
+		originalFile, err := os.Open(oldFileName)
+		if err != nil {
+			logger.Error("error opening originalFile", "err", err)
+			return nil, err
+		}
+		defer originalFile.Close()
+		stats, err := originalFile.Stat()
+		if err != nil {
+			logger.Error("error getting originalFile stats", "err", err)
+			return nil, err
+		}
+		if util.IsEmpty(stats) {
+			err := ErrEmptyOriginalFile
+			logger.Error(err.Error())
+			return nil, err
+		}
+		basis = originalFile
+		if opts != nil && opts.Mmap {
+			if m := mmapFile(originalFile, logger); m != nil {
+				defer m.Close()
+				basis = m
+			}
+		}
+	}
+
+	// New file
+	updated := opts.stdin()
+	if newFileName != util.StdioName {
+		updatedFile, err := os.Open(newFileName)
+		if err != nil {
+			logger.Error("error opening updatedFile", "err", err)
+			return nil, err
+		}
+		defer updatedFile.Close()
+		stats, err := updatedFile.Stat()
+		if err != nil {
+			logger.Error("error getting updatedFile stats", "err", err)
+			return nil, err
+		}
+		if util.IsEmpty(stats) {
+			err := ErrEmptyUpdatedFile
+			logger.Error(err.Error())
+			return nil, err
+		}
+
+		updated = updatedFile
+		if opts != nil && opts.Mmap {
+			if m := mmapFile(updatedFile, logger); m != nil {
+				defer m.Close()
+				updated = m
+			}
+		}
+	}
+
 	// Delta file
-	d.deltaFile, err = os.OpenFile(deltaFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	deltaFile := opts.stdout()
+	var atomicFile *util.AtomicFile
+	if deltaFileName != util.StdioName {
+		f, err := util.CreateAtomic(deltaFileName, opts != nil && opts.Overwrite)
+		if err != nil {
+			logger.Error("error creating deltaFile", "err", err)
+			return nil, err
+		}
+		defer f.Close()
+		deltaFile, atomicFile = f, f
+	}
+
+	deltaStats, err := Generate(deltaFile, sig, basis, updated, opts)
 	if err != nil {
-		log.Printf("error creating deltaFile: %s", err)
 		return nil, err
 	}
+	if atomicFile != nil {
+		err = atomicFile.Commit()
+		if err != nil {
+			logger.Error("error writing to delta file", "err", err)
+			return nil, err
+		}
+	}
+	deltaStats.Elapsed = time.Since(start)
+	return deltaStats, nil
+}
 
-	d.currCmd = NO_CMD
-	d.currChunk = make([]byte, d.chunkLen)
+// checkStdin checks the files read from stdin
+// the original file is read at random offsets, so it can't be read from stdin,
+// and only one of the other input files can be read from stdin
+func checkStdin(originalFileName string, inputFileNames []string, logger *slog.Logger) error {
+	if originalFileName == util.StdioName {
+		err := ErrStdinOriginalFile
+		logger.Error(err.Error())
+		return err
+	}
+	stdin := 0
+	for _, name := range inputFileNames {
+		if name == util.StdioName {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		err := ErrStdinReadTwice
+		logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// mmapFile maps f in memory, it returns nil when f can't be mapped and must be read instead
+func mmapFile(f *os.File, logger *slog.Logger) *util.MappedFile {
+	m, err := util.Mmap(f)
+	if err != nil {
+		logger.Info("reading file instead of mapping it", "file", f.Name(), "err", err)
+		return nil
+	}
+	logger.Info("file mapped", "file", f.Name())
+	return m
+}
 
-	err = util.WriteUint32InHex(d.deltaFile, d.chunkLen)
+// Generate generates the delta of updated against the signature and writes it to w
+// basis is the original file, it can be nil if the signature contains strong hashes
+// It returns the statistics of the generated delta.
+func Generate(w io.Writer, sig *signature.Signature, basis io.ReaderAt, updated io.Reader, opts *Options) (*Stats, error) {
+	start := time.Now()
+	d, err := newDelta(w, sig, basis, updated, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return &d, nil
-}
+	size, sized := util.Size(updated)
+	updatedAt, isReaderAt := updated.(io.ReaderAt)
+	segments := d.matchCmd != COPY && opts != nil && opts.Jobs > 1 && sized && isReaderAt
+	if d.flags&FLAG_CHECKSUM != 0 {
+		err = d.digestUpdated(updatedAt, segments || d.updatedData != nil)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-func (d *delta) cleanup() {
-	d.originalFile.Close()
-	d.deltaFile.Close()
-	d.updatedFile.Close()
-}
+	if d.matchCmd == COPY {
+		err = d.searchVariableChunks(sig)
+	} else if segments {
+		d.log.Info("searching segments concurrently", "jobs", opts.Jobs)
+		err = d.searchSegments(updatedAt, size, opts.Jobs)
+	} else {
+		err = d.searchFixedChunks()
+	}
+	if err != nil {
+		return nil, err
+	}
 
-// GenerateDelta generates the delta file
-// signature and original file both are required for genearing delta,
-// as just matching of hash can't guarantee matching of the chunks
-func GenerateDelta(oldFileName, sigFileName, newFileName, deltaFileName string) error {
-	d, err := newDelta(oldFileName, sigFileName, newFileName, deltaFileName)
+	if d.currCmd == NO_CMD {
+		err := ErrEmptyUpdatedFile
+		d.log.Error(err.Error())
+		return nil, err
+	}
+	err = d.writeToDeltaFile()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if d.format == format.LIBRSYNC {
+		err = d.writeLibrsyncEnd()
+	} else {
+		err = d.writeChecksum()
+	}
+	if err != nil {
+		return nil, err
 	}
-	defer d.cleanup()
 
+	err = d.deltaFile.Flush()
+	if err != nil {
+		d.log.Error("error writing to delta file", "err", err)
+		return nil, err
+	}
+
+	d.stats.DeltaBytes = d.output.n
+	d.stats.Elapsed = time.Since(start)
+	d.log.Info("delta generated", "matchedBytes", d.stats.MatchedBytes, "literalBytes", d.stats.LiteralBytes,
+		"weakHashHits", d.stats.WeakHashHits, "falsePositives", d.stats.FalsePositives, "deltaBytes", d.stats.DeltaBytes)
+	return &d.stats, nil
+}
+
+// searchFixedChunks searches the fixed size chunks of the signature in the updated file
+// the chunks are searched at every byte offset of the updated file
+func (d *delta) searchFixedChunks() error {
+	if d.updatedData != nil {
+		d.window = newMappedWindow(d.updatedData)
+	} else {
+		d.window = newWindow(d.updated, d.chunkLen)
+	}
+	var err error
 	for {
 		if d.currCmd == NO_CMD || d.currCmd == MATCH {
 			err = d.readFullChunk()
@@ -176,51 +623,89 @@ func GenerateDelta(oldFileName, sigFileName, newFileName, deltaFileName string)
 		if d.currCmd == LITERAL {
 			d.skipFirstByte()
 		} else {
-			d.currChunk = []byte{}
+			d.window.clear()
+			d.currChunk = d.window.bytes()
 		}
 	}
+	return nil
+}
+
+// searchVariableChunks searches the content defined chunks of the signature in the updated file
+// the updated file is split with the same chunker, so only its chunk boundaries are searched
+func (d *delta) searchVariableChunks(sig *signature.Signature) error {
+	chunker := signature.NewChunker(d.updated, sig.MinChunkLen, sig.ChunkLen, sig.MaxChunkLen)
+	for {
+		chunk, err := chunker.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			d.log.Error("error reading updatedFile", "err", err)
+			return err
+		}
+		d.currChunk = chunk
+		d.hash.Reset()
+		d.hash.Write(chunk)
+
+		match, index, err := d.searchChunk()
+		if err != nil {
+			return err
+		}
+		if match {
+			err = d.chunkFound(index)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 
-	return d.writeToDeltaFile()
+		for len(d.currChunk) > 0 {
+			err = d.literalFound()
+			if err != nil {
+				return err
+			}
+			d.currChunk = d.currChunk[1:]
+		}
+	}
 }
 
 // readFullChunk tries to read the fullChunk from the newFile
 func (d *delta) readFullChunk() error {
-	n, err := d.updatedFile.Read(d.currChunk)
+	err := d.window.next(int(d.chunkLen))
+	d.currChunk = d.window.bytes()
+	d.hash.Reset()
 	if err != nil {
-		if err == io.EOF {
-			d.currChunk = []byte{}
-			d.hash = 0
-			d.pow = 0
+		if err != io.EOF {
+			d.log.Error("error reading updatedFile", "err", err)
 		}
 		return err
 	}
-	d.currChunk = d.currChunk[:n]
-	d.hash, d.pow = rabinkarp.Hash(d.currChunk)
+	d.hash.Write(d.currChunk)
 	return nil
 }
 
 // readNextByte tries to read the next byte and rotate the chunk
 func (d *delta) readNextByte() error {
-	b := make([]byte, 1)
-	_, err := d.updatedFile.Read(b)
+	out, in, err := d.window.roll()
 	if err != nil {
 		if err == io.EOF {
 			d.skipFirstByte()
 			return nil
 		}
+		d.log.Error("error reading updatedFile", "err", err)
 		return err
 	}
 
-	d.hash = rabinkarp.Rotate(d.hash, d.pow, uint32(d.currChunk[0]), uint32(b[0]))
-	d.currChunk = d.currChunk[1:]
-	d.currChunk = append(d.currChunk, b[0])
+	d.hash.Roll(out, in)
+	d.currChunk = d.window.bytes()
 	return nil
 }
 
 // skipFirstByte skips the first byte of the currChunk and calculates the hash
 func (d *delta) skipFirstByte() {
-	d.hash, d.pow = rabinkarp.RollOut(d.hash, d.pow, uint32(d.currChunk[0]))
-	d.currChunk = d.currChunk[1:]
+	d.hash.RollOut(d.currChunk[0])
+	d.window.skip()
+	d.currChunk = d.window.bytes()
 }
 
 // searchAndUpdate searches for the currChunk in oldFile and updates the delta information
@@ -237,38 +722,125 @@ func (d *delta) searchAndUpdate() error {
 }
 
 // searchChunk searches for the currChunk in oldFile
+// when several chunks share the hash, the chunk continuing the current MATCH is preferred,
+// otherwise the candidates are tried in ascending order
 func (d *delta) searchChunk() (bool, uint32, error) {
-	log.Printf("searching Hash: %08x", d.hash)
-	index, ok := d.hashmap[d.hash]
+	hash := d.sum()
+	if d.debug {
+		d.log.Debug("searching hash", "hash", fmt.Sprintf("%08x", hash))
+	}
+	indexes, ok := d.hashmap[hash]
 	if !ok {
 		return false, 0, nil
 	}
+	d.stats.WeakHashHits++
 
-	//read the chunk from oldFile and compare the content
-	oldFileChunk := make([]byte, d.chunkLen)
-	n, err := d.originalFile.ReadAt(oldFileChunk, int64(index*d.chunkLen))
-	if err != nil && err != io.EOF {
-		log.Printf("error reading file: %s", err)
-		return false, 0, err
+	var strongHash []byte
+	if d.strongHash != signature.STRONG_HASH_NONE {
+		strongHash = d.strongHash.Sum(d.currChunk)
+	}
+
+	if d.currCmd == d.matchCmd && len(indexes) > 1 {
+		for _, index := range indexes {
+			if index != d.endChunkIndex+1 {
+				continue
+			}
+			match, err := d.verifyChunk(index, strongHash)
+			if err != nil || match {
+				return match, index, err
+			}
+			break
+		}
+	}
+
+	for _, index := range indexes {
+		match, err := d.verifyChunk(index, strongHash)
+		if err != nil || match {
+			return match, index, err
+		}
+	}
+
+	d.stats.FalsePositives++
+	return false, 0, nil
+}
+
+// sum returns the hash of the window with the width of the signature hashes
+func (d *delta) sum() uint64 {
+	if d.hash64 {
+		return d.hash.Sum64()
+	}
+	return uint64(d.hash.Sum32())
+}
+
+// verifyChunk verifies that the content of the currChunk matches with the chunk at index in oldFile
+// strongHash is the strong hash of the currChunk when the signature contains strong hashes
+func (d *delta) verifyChunk(index uint32, strongHash []byte) (bool, error) {
+	if d.chunkLens != nil && len(d.currChunk) != int(d.chunkLens[index]) {
+		return false, nil
+	}
+	if strongHash != nil {
+		// the strong hashes of librsync signatures can be truncated
+		if string(strongHash[:len(d.strongHashes[index])]) != string(d.strongHashes[index]) {
+			d.log.Debug("strong hash does not match", "hash", fmt.Sprintf("%08x", d.sum()), "chunk", index)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	offset, chunkLen := d.chunkRange(index)
+	if len(d.currChunk) > chunkLen {
+		return false, nil
 	}
-	oldFileChunk = oldFileChunk[:n]
 
+	oldFileChunk, err := d.readOldChunk(offset, chunkLen)
+	if err != nil {
+		return false, err
+	}
 	if string(oldFileChunk) != string(d.currChunk) {
-		log.Printf("Hash: %08x matched but chunk contains does not matched", d.hash)
-		return false, 0, nil
+		d.log.Debug("chunk content does not match", "hash", fmt.Sprintf("%08x", d.sum()), "chunk", index)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// readOldChunk returns the chunk of oldFile at offset, it is shorter than chunkLen at the end of oldFile
+// the chunk is only valid until the next call
+func (d *delta) readOldChunk(offset int64, chunkLen int) ([]byte, error) {
+	// a memory mapped oldFile is compared without reading it
+	if d.originalData != nil {
+		end := min(offset+int64(chunkLen), int64(len(d.originalData)))
+		return d.originalData[min(offset, end):end], nil
+	}
+
+	if cap(d.oldChunk) < chunkLen {
+		d.oldChunk = make([]byte, chunkLen)
+	}
+	n, err := d.original.ReadAt(d.oldChunk[:chunkLen], offset)
+	if err != nil && err != io.EOF {
+		d.log.Error("error reading originalFile", "err", err)
+		return nil, err
 	}
+	return d.oldChunk[:n], nil
+}
 
-	return true, index, nil
+// chunkRange returns the offset and the length of the chunk at index in oldFile
+// the last fixed size chunk can be shorter than the returned length
+func (d *delta) chunkRange(index uint32) (int64, int) {
+	if d.chunkLens != nil {
+		return d.chunkOffsets[index], int(d.chunkLens[index])
+	}
+	return int64(index) * int64(d.chunkLen), int(d.chunkLen)
 }
 
 // chunkFound is called when currChunk matches with a chunk in oldFile
 func (d *delta) chunkFound(index uint32) error {
-	log.Printf("Chunk matched: %d\n", index)
+	d.log.Debug("chunk matched", "chunk", index)
 
-	if d.currCmd == MATCH && d.endChunkIndex+1 == index {
+	if d.currCmd == d.matchCmd && d.endChunkIndex+1 == index {
 		d.endChunkIndex++
-		d.hash = 0
-		d.pow = 0
+		d.matchLen += int64(len(d.currChunk))
+		d.hash.Reset()
 		return nil
 	}
 
@@ -279,20 +851,29 @@ func (d *delta) chunkFound(index uint32) error {
 		}
 	}
 
-	d.currCmd = MATCH
+	d.currCmd = d.matchCmd
 	d.startChunkIndex = index
 	d.endChunkIndex = index
-	d.hash = 0
-	d.pow = 0
+	d.matchLen = int64(len(d.currChunk))
+	d.hash.Reset()
 	return nil
 }
 
 // literalFound is called when literal is found
 // that is because currChunk does not match with any chunk in oldFile
 func (d *delta) literalFound() error {
-	log.Printf("Found literal: %s\n", string(d.currChunk[0]))
+	if d.debug {
+		d.log.Debug("literal found", "byte", d.currChunk[0])
+	}
 
-	if d.currCmd == MATCH {
+	if d.currCmd == d.matchCmd {
+		err := d.writeToDeltaFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.currCmd == LITERAL && len(d.literals) == MaxLiteralLen {
 		err := d.writeToDeltaFile()
 		if err != nil {
 			return err
@@ -304,37 +885,77 @@ func (d *delta) literalFound() error {
 	return nil
 }
 
+// writeHeader writes the magic, format version, flags and chunk length to the delta file
+// librsync deltas only start with their magic
+func (d *delta) writeHeader() error {
+	if d.format == format.LIBRSYNC {
+		_, err := d.deltaFile.Write(binary.BigEndian.AppendUint32(nil, format.RS_DELTA_MAGIC))
+		if err != nil {
+			d.log.Error("error writing to delta file", "err", err)
+		}
+		return err
+	}
+	header := format.Header{Magic: format.DeltaMagic, Version: DeltaVersionLatest, Flags: d.flags}
+	err := header.Write(d.deltaFile)
+	if err == nil {
+		err = util.WriteUint32InHex(d.deltaFile, d.chunkLen)
+	}
+	if err == nil {
+		err = d.writeChecksumHeader()
+	}
+	if err != nil {
+		d.log.Error("error writing to delta file", "err", err)
+		return err
+	}
+	return nil
+}
+
 // writeToDeltaFile writes the current command to the delta file
 func (d *delta) writeToDeltaFile() error {
-	var content string
+	if d.segment {
+		d.collectRecord()
+		return nil
+	}
+
+	data := []byte{byte(d.currCmd)}
 	if d.currCmd == MATCH {
-		content = fmt.Sprintf("%02x%03x%03x", d.currCmd, d.startChunkIndex, d.endChunkIndex)
+		data = binary.AppendUvarint(data, uint64(d.startChunkIndex))
+		data = binary.AppendUvarint(data, uint64(d.endChunkIndex))
+		d.stats.MatchRecords++
+		d.stats.MatchedBytes += uint64(d.matchLen)
+	} else if d.currCmd == COPY {
+		offset := d.chunkOffsets[d.startChunkIndex]
+		end := d.chunkOffsets[d.endChunkIndex] + int64(d.chunkLens[d.endChunkIndex])
+		data = binary.AppendUvarint(data, uint64(offset))
+		data = binary.AppendUvarint(data, uint64(end-offset))
+		d.stats.MatchRecords++
+		d.stats.MatchedBytes += uint64(d.matchLen)
 	} else if d.currCmd == LITERAL {
-		content = fmt.Sprintf("%02x%06x", d.currCmd, len(d.literals))
+		data = binary.AppendUvarint(data, uint64(len(d.literals)))
+		d.stats.LiteralRecords++
+		d.stats.LiteralBytes += uint64(len(d.literals))
 	} else {
 		err := fmt.Errorf("can't write invalid command:%d to delta file", d.currCmd)
-		log.Println(err)
+		d.log.Error(err.Error())
 		return err
 	}
-
-	data, err := hex.DecodeString(content)
-	if err != nil {
-		log.Printf("error decoding hex string: %s", err)
-		return err
+	if d.format == format.LIBRSYNC {
+		data = d.librsyncCmd()
 	}
-	_, err = d.deltaFile.Write(data)
+
+	_, err := d.deltaFile.Write(data)
 	if err != nil {
-		log.Printf("error writing to delta file: %s", err)
+		d.log.Error("error writing to delta file", "err", err)
 		return err
 	}
 
 	if d.currCmd == LITERAL {
 		_, err = d.deltaFile.Write(d.literals)
 		if err != nil {
-			log.Printf("error writing literals to delta file: %s", err)
+			d.log.Error("error writing literals to delta file", "err", err)
 			return err
 		}
-		d.literals = nil
+		d.literals = d.literals[:0]
 	}
 
 	return nil
@@ -1,11 +1,21 @@
 package delta_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/signature"
 	"github.com/SDkie/rollinghash/pkg/util"
 	"github.com/google/uuid"
 )
@@ -15,6 +25,10 @@ import (
 // TestX.sig    : Signature file
 // TestX.update : Updated file
 // TestX.delta  : Delta file
+// TestX.v0.delta : Legacy (version 0) delta file
+// TestX.checksum.delta : Delta file with BLAKE2b checksums
+// TestX.rdiff.sig, TestX.rdiff.delta : librsync signature and delta files, written by an independent implementation of the librsync format
+// the librsync files were not written by rdiff, TestRunRdiff of cmd/rollinghash compares them with rdiff when it is installed
 
 func TestGenerateDelta(t *testing.T) {
 	cases := []struct {
@@ -47,9 +61,14 @@ func TestGenerateDelta(t *testing.T) {
 		{name: "Large Chunk with some literals at the end", testNo: 19, expError: nil},
 		{name: "Large Chunk with some literals missing in the middle", testNo: 20, expError: nil},
 
+		{name: "Four Chunk file with duplicate chunks", testNo: 21, expError: nil},
+		{name: "Four Chunk file with duplicate chunks moved", testNo: 22, expError: nil},
+
 		// Unhappy Paths
 		{name: "Empty Original file", testNo: 101, expError: delta.ErrEmptyOriginalFile},
 		{name: "Empty Updated file", testNo: 102, expError: delta.ErrEmptyUpdatedFile},
+		{name: "Original file changed since the signature", testNo: 115, expError: delta.ErrSignatureMismatch},
+		{name: "Original file truncated since the signature", testNo: 116, expError: delta.ErrSignatureMismatch},
 	}
 
 	for _, c := range cases {
@@ -62,7 +81,7 @@ func TestGenerateDelta(t *testing.T) {
 			deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
 			defer os.Remove(deltafile)
 
-			err := delta.GenerateDelta(inputfile, sigfile, updatedfile, deltafile)
+			_, err := delta.GenerateDelta(inputfile, sigfile, updatedfile, deltafile, nil)
 			if err != c.expError {
 				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
 			}
@@ -82,3 +101,1006 @@ func TestGenerateDelta(t *testing.T) {
 		t.Run(c.name, tf)
 	}
 }
+
+func TestGenerateDeltaWithMmap(t *testing.T) {
+	for _, jobs := range []int{1, 4} {
+		for testNo := 1; testNo <= 22; testNo++ {
+			tf := func(t *testing.T) {
+				inputfile := fmt.Sprintf("testdata/test%d.org", testNo)
+				sigfile := fmt.Sprintf("testdata/test%d.sig", testNo)
+				updatedfile := fmt.Sprintf("testdata/test%d.update", testNo)
+				expectedDeltafile := fmt.Sprintf("testdata/test%d.delta", testNo)
+
+				deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+				defer os.Remove(deltafile)
+
+				_, err := delta.GenerateDelta(inputfile, sigfile, updatedfile, deltafile, &delta.Options{Jobs: jobs, Mmap: true})
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+
+				match, err := util.CompareFileContents(deltafile, expectedDeltafile)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+				if !match {
+					t.Fatalf("'%s' Failed : delta file contents do not match", t.Name())
+				}
+			}
+
+			t.Run(fmt.Sprintf("%d jobs test%d", jobs, testNo), tf)
+		}
+	}
+
+	t.Run("Segments of a large file", func(t *testing.T) {
+		dir := t.TempDir()
+		original := make([]byte, 5*delta.MinSegmentLen+777)
+		rand.New(rand.NewSource(1)).Read(original)
+		updated := append([]byte(nil), original...)
+		copy(updated[delta.MinSegmentLen-2:], "edit at segment edge")
+
+		inputfile := filepath.Join(dir, "input.org")
+		updatedfile := filepath.Join(dir, "input.update")
+		sigfile := filepath.Join(dir, "input.sig")
+		err := os.WriteFile(inputfile, original, 0666)
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		err = os.WriteFile(updatedfile, updated, 0666)
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		_, err = signature.GenerateSignature(inputfile, sigfile, &signature.Options{Mmap: true})
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+
+		// the mapped files give the same delta as the files read
+		deltafile := filepath.Join(dir, "input.delta")
+		expectedDeltafile := filepath.Join(dir, "expected.delta")
+		_, err = delta.GenerateDelta(inputfile, sigfile, updatedfile, expectedDeltafile, &delta.Options{Jobs: 4})
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		_, err = delta.GenerateDelta(inputfile, sigfile, updatedfile, deltafile, &delta.Options{Jobs: 4, Mmap: true})
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+
+		match, err := util.CompareFileContents(deltafile, expectedDeltafile)
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		if !match {
+			t.Fatalf("'%s' Failed : delta file contents do not match", t.Name())
+		}
+	})
+
+	// empty files can't be mapped, they are still rejected
+	t.Run("Empty Updated file", func(t *testing.T) {
+		deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+		defer os.Remove(deltafile)
+
+		_, err := delta.GenerateDelta("testdata/test102.org", "testdata/test102.sig", "testdata/test102.update", deltafile, &delta.Options{Mmap: true})
+		if err != delta.ErrEmptyUpdatedFile {
+			t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), delta.ErrEmptyUpdatedFile, err)
+		}
+	})
+}
+
+func TestGenerateDeltaWithStrongHash(t *testing.T) {
+	strongHashes := []signature.StrongHashType{
+		signature.STRONG_HASH_BLAKE2B,
+		signature.STRONG_HASH_SHA256,
+		signature.STRONG_HASH_XXH3,
+	}
+
+	for _, strongHash := range strongHashes {
+		for testNo := 1; testNo <= 22; testNo++ {
+			tf := func(t *testing.T) {
+				inputfile := fmt.Sprintf("testdata/test%d.org", testNo)
+				updatedfile := fmt.Sprintf("testdata/test%d.update", testNo)
+				expectedDeltafile := fmt.Sprintf("testdata/test%d.delta", testNo)
+
+				sigfile := fmt.Sprintf("testdata/%s.sig", uuid.New().String())
+				defer os.Remove(sigfile)
+				deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+				defer os.Remove(deltafile)
+
+				_, err := signature.GenerateSignature(inputfile, sigfile, &signature.Options{StrongHash: strongHash})
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+
+				// original file is not needed, matches are verified with the strong hashes
+				_, err = delta.GenerateDelta("", sigfile, updatedfile, deltafile, nil)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+
+				match, err := util.CompareFileContents(deltafile, expectedDeltafile)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+				if !match {
+					t.Fatalf("'%s' Failed : delta file contents do not match", t.Name())
+				}
+			}
+
+			t.Run(fmt.Sprintf("%s test%d", strongHash, testNo), tf)
+		}
+	}
+
+	t.Run("Missing original file without strong hash", func(t *testing.T) {
+		deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+		defer os.Remove(deltafile)
+
+		_, err := delta.GenerateDelta("", "testdata/test1.sig", "testdata/test1.update", deltafile, nil)
+		if err != delta.ErrMissingOriginalFile {
+			t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), delta.ErrMissingOriginalFile, err)
+		}
+	})
+}
+
+func TestGenerateAndApply(t *testing.T) {
+	for testNo := 1; testNo <= 22; testNo++ {
+		tf := func(t *testing.T) {
+			original, err := os.ReadFile(fmt.Sprintf("testdata/test%d.org", testNo))
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			updated, err := os.ReadFile(fmt.Sprintf("testdata/test%d.update", testNo))
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			expectedDelta, err := os.ReadFile(fmt.Sprintf("testdata/test%d.delta", testNo))
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			var sigBuf, deltaBuf, outputBuf bytes.Buffer
+			sig, err := signature.Write(&sigBuf, bytes.NewReader(original), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			// io.MultiReader hides the size of the updated file
+			_, err = delta.Generate(&deltaBuf, sig, bytes.NewReader(original), io.MultiReader(bytes.NewReader(updated)), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !bytes.Equal(deltaBuf.Bytes(), expectedDelta) {
+				t.Fatalf("'%s' Failed : delta contents do not match", t.Name())
+			}
+
+			err = delta.Apply(&outputBuf, bytes.NewReader(original), &deltaBuf, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !bytes.Equal(outputBuf.Bytes(), updated) {
+				t.Fatalf("'%s' Failed : updated contents do not match", t.Name())
+			}
+		}
+
+		t.Run(fmt.Sprintf("test%d", testNo), tf)
+	}
+
+	t.Run("Empty Updated file", func(t *testing.T) {
+		sig, err := signature.ReadSignature("testdata/test1.sig", nil)
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+
+		var deltaBuf bytes.Buffer
+		_, err = delta.Generate(&deltaBuf, sig, bytes.NewReader(make([]byte, 256)), io.MultiReader(), nil)
+		if err != delta.ErrEmptyUpdatedFile {
+			t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), delta.ErrEmptyUpdatedFile, err)
+		}
+		if deltaBuf.Len() != 0 {
+			t.Fatalf("'%s' Failed : expected no output, got %d bytes", t.Name(), deltaBuf.Len())
+		}
+	})
+}
+
+func TestGenerateWithReaders(t *testing.T) {
+	errRead := errors.New("read error")
+	cases := []struct {
+		name     string
+		testNo   int
+		reader   func(r io.Reader) io.Reader
+		expError error
+	}{
+		// Happy Paths
+		{name: "One byte reads", testNo: 8, reader: iotest.OneByteReader, expError: nil},
+		{name: "Half reads", testNo: 20, reader: iotest.HalfReader, expError: nil},
+		{name: "Error with last read", testNo: 19, reader: iotest.DataErrReader, expError: nil},
+
+		// Unhappy Paths
+		{name: "Read error in literals", testNo: 19, reader: func(r io.Reader) io.Reader {
+			return io.MultiReader(io.LimitReader(r, 1000), iotest.ErrReader(errRead))
+		}, expError: errRead},
+		{name: "Read error after a chunk", testNo: 8, reader: func(r io.Reader) io.Reader {
+			return io.MultiReader(io.LimitReader(r, 256), iotest.ErrReader(errRead))
+		}, expError: errRead},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			sig, err := signature.ReadSignature(fmt.Sprintf("testdata/test%d.sig", c.testNo), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			original, err := os.ReadFile(fmt.Sprintf("testdata/test%d.org", c.testNo))
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			updated, err := os.ReadFile(fmt.Sprintf("testdata/test%d.update", c.testNo))
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			expectedDelta, err := os.ReadFile(fmt.Sprintf("testdata/test%d.delta", c.testNo))
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			var deltaBuf bytes.Buffer
+			_, err = delta.Generate(&deltaBuf, sig, bytes.NewReader(original), c.reader(bytes.NewReader(updated)), nil)
+			if err != c.expError {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(deltaBuf.Bytes(), expectedDelta) {
+				t.Fatalf("'%s' Failed : delta contents do not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestGenerateAndApplyCDC(t *testing.T) {
+	original := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(original)
+
+	insert := func(data []byte, at int, s string) []byte {
+		out := append([]byte(nil), data[:at]...)
+		out = append(out, s...)
+		return append(out, data[at:]...)
+	}
+
+	cases := []struct {
+		name       string
+		updated    []byte
+		strongHash signature.StrongHashType
+		noOriginal bool
+	}{
+		{name: "Same file", updated: original},
+		{name: "Insertion near the start", updated: insert(original, 100, "inserted bytes")},
+		{name: "Insertions in the middle", updated: insert(insert(original, 500000, "first"), 200000, "second")},
+		{name: "Deletion", updated: append(append([]byte(nil), original[:300000]...), original[310000:]...)},
+		{name: "Different file", updated: original[:1000:1000]},
+		{name: "Strong hash without original", updated: insert(original, 100, "inserted bytes"), strongHash: signature.STRONG_HASH_SHA256, noOriginal: true},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var sigBuf, deltaBuf, outputBuf bytes.Buffer
+			opts := &signature.Options{StrongHash: c.strongHash, CDC: &signature.CDCOptions{}}
+			sig, err := signature.Write(&sigBuf, bytes.NewReader(original), opts)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			var basis io.ReaderAt = bytes.NewReader(original)
+			if c.noOriginal {
+				basis = nil
+			}
+			_, err = delta.Generate(&deltaBuf, sig, basis, bytes.NewReader(c.updated), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			// a few chunks around the changes are sent as literals
+			if len(c.updated) > 1000 && deltaBuf.Len() > 5*signature.DefaultMaxChunkLen {
+				t.Fatalf("'%s' Failed : delta is too large: %d bytes", t.Name(), deltaBuf.Len())
+			}
+
+			err = delta.Apply(&outputBuf, bytes.NewReader(original), &deltaBuf, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !bytes.Equal(outputBuf.Bytes(), c.updated) {
+				t.Fatalf("'%s' Failed : updated contents do not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestGenerateDeltaWithHashTypes(t *testing.T) {
+	hashTypes := []rollinghash.Type{rollinghash.RABINKARP, rollinghash.ROLLSUM, rollinghash.BUZHASH, rollinghash.GEAR, rollinghash.RABINKARP64}
+
+	for _, hashType := range hashTypes {
+		for _, hash64 := range []bool{false, true} {
+			for testNo := 1; testNo <= 22; testNo++ {
+				tf := func(t *testing.T) {
+					original, err := os.ReadFile(fmt.Sprintf("testdata/test%d.org", testNo))
+					if err != nil {
+						t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+					}
+					updated, err := os.ReadFile(fmt.Sprintf("testdata/test%d.update", testNo))
+					if err != nil {
+						t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+					}
+					expectedDelta, err := os.ReadFile(fmt.Sprintf("testdata/test%d.delta", testNo))
+					if err != nil {
+						t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+					}
+
+					var sigBuf, deltaBuf bytes.Buffer
+					sig, err := signature.Write(&sigBuf, bytes.NewReader(original), &signature.Options{Hash: hashType, Hash64: hash64})
+					if err != nil {
+						t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+					}
+
+					// chunks are verified with the original file, so every hash type gives the same delta
+					_, err = delta.Generate(&deltaBuf, sig, bytes.NewReader(original), bytes.NewReader(updated), nil)
+					if err != nil {
+						t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+					}
+					if !bytes.Equal(deltaBuf.Bytes(), expectedDelta) {
+						t.Fatalf("'%s' Failed : delta contents do not match", t.Name())
+					}
+				}
+
+				name := fmt.Sprintf("%s test%d", hashType, testNo)
+				if hash64 {
+					name = fmt.Sprintf("%s 64 bits test%d", hashType, testNo)
+				}
+				t.Run(name, tf)
+			}
+		}
+	}
+
+	t.Run("Hash type of legacy signature", func(t *testing.T) {
+		deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+		defer os.Remove(deltafile)
+
+		hashType := rollinghash.RABINKARP
+		_, err := delta.GenerateDelta("testdata/test5.org", "testdata/test5.sig", "testdata/test5.update", deltafile, &delta.Options{HashType: &hashType})
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+
+		match, err := util.CompareFileContents(deltafile, "testdata/test5.delta")
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		if !match {
+			t.Fatalf("'%s' Failed : delta file contents do not match", t.Name())
+		}
+	})
+
+	t.Run("Hash type mismatch", func(t *testing.T) {
+		deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+		defer os.Remove(deltafile)
+
+		hashType := rollinghash.BUZHASH
+		_, err := delta.GenerateDelta("testdata/test21.org", "testdata/test21.sig", "testdata/test21.update", deltafile, &delta.Options{HashType: &hashType})
+		if err != delta.ErrHashTypeMismatch {
+			t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), delta.ErrHashTypeMismatch, err)
+		}
+	})
+}
+
+func TestApplyDelta(t *testing.T) {
+	cases := []struct {
+		name     string
+		testNo   int
+		expError error
+	}{
+		// Happy Paths
+		{name: "One Chunk file with no changes", testNo: 1, expError: nil},
+		{name: "One Chunk file with literals at start", testNo: 2, expError: nil},
+		{name: "One Chunk file with literals at end", testNo: 3, expError: nil},
+
+		{name: "Two Chunk file with no changes", testNo: 4, expError: nil},
+		{name: "Two Chunk file with literals at start", testNo: 5, expError: nil},
+		{name: "Two Chunk file with literals at middle", testNo: 6, expError: nil},
+		{name: "Two Chunk file with literals at end", testNo: 7, expError: nil},
+		{name: "Two Chunk file with literals at start, middle and end", testNo: 8, expError: nil},
+		{name: "Two Chunk file with trimmed first chunk", testNo: 9, expError: nil},
+		{name: "Two Chunk file with some chars replaced in first chunk", testNo: 10, expError: nil},
+		{name: "Two Chunk file with chunk swapped", testNo: 11, expError: nil},
+		{name: "Two Chunk file with duplicate chunks in updated file", testNo: 12, expError: nil},
+		{name: "Two Chunk file with missing first chunk in updated file", testNo: 13, expError: nil},
+		{name: "Two Chunk file with missing second chunk in updated file", testNo: 14, expError: nil},
+		{name: "Two Chunk file with updated file having no common data", testNo: 15, expError: nil},
+
+		{name: "Small Chunk with some literals at the start", testNo: 16, expError: nil},
+		{name: "Small Chunk with some literals at the end", testNo: 17, expError: nil},
+
+		{name: "Large Chunk with some literals at the start", testNo: 18, expError: nil},
+		{name: "Large Chunk with some literals at the end", testNo: 19, expError: nil},
+		{name: "Large Chunk with some literals missing in the middle", testNo: 20, expError: nil},
+
+		{name: "Four Chunk file with duplicate chunks", testNo: 21, expError: nil},
+		{name: "Four Chunk file with duplicate chunks moved", testNo: 22, expError: nil},
+
+		{name: "librsync delta with every opcode", testNo: 23, expError: nil},
+
+		// Unhappy Paths
+		{name: "Empty Original file", testNo: 101, expError: delta.ErrEmptyOriginalFile},
+		{name: "Chunk length mismatch", testNo: 103, expError: delta.ErrChunkLenMismatch},
+		{name: "Unknown command", testNo: 104, expError: delta.ErrInvalidDeltaFile},
+		{name: "Legacy chunk index out of original file", testNo: 105, expError: delta.ErrChunkLenMismatch},
+		{name: "Truncated literals", testNo: 106, expError: delta.ErrInvalidDeltaFile},
+		{name: "Unsupported version", testNo: 107, expError: delta.ErrInvalidDeltaFile},
+		{name: "Signature file", testNo: 108, expError: delta.ErrInvalidDeltaFile},
+		{name: "Copy range out of original file", testNo: 109, expError: delta.ErrInvalidDeltaFile},
+		{name: "Match record in delta with copy records", testNo: 110, expError: delta.ErrInvalidDeltaFile},
+		{name: "Chunk length below format limit", testNo: 111, expError: delta.ErrInvalidDeltaFile},
+		{name: "Original file not matching checksum", testNo: 112, expError: delta.ErrOriginalMismatch},
+		{name: "Updated file not matching checksum", testNo: 113, expError: delta.ErrUpdatedMismatch},
+		{name: "Missing checksum record", testNo: 114, expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync missing end command", testNo: 117, expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync unknown opcode", testNo: 118, expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync data after end command", testNo: 119, expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync empty copy", testNo: 120, expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync copy out of original file", testNo: 121, expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync truncated copy", testNo: 122, expError: delta.ErrInvalidDeltaFile},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			inputfile := fmt.Sprintf("testdata/test%d.org", c.testNo)
+			deltafile := fmt.Sprintf("testdata/test%d.delta", c.testNo)
+			expectedUpdatedfile := fmt.Sprintf("testdata/test%d.update", c.testNo)
+
+			outputfile := fmt.Sprintf("testdata/%s.update", uuid.New().String())
+			defer os.Remove(outputfile)
+
+			err := delta.ApplyDelta(inputfile, deltafile, outputfile, nil)
+			if err != c.expError {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				// the partial output is removed
+				_, err = os.Stat(outputfile)
+				if !errors.Is(err, fs.ErrNotExist) {
+					t.Fatalf("'%s' Failed : expected no output file, got error:%v", t.Name(), err)
+				}
+				return
+			}
+
+			match, err := util.CompareFileContents(outputfile, expectedUpdatedfile)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !match {
+				t.Fatalf("'%s' Failed : updated file contents do not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestApplyLegacyDelta(t *testing.T) {
+	cases := []struct {
+		name   string
+		testNo int
+	}{
+		{name: "One Chunk file with no changes", testNo: 1},
+		{name: "Two Chunk file with literals at start, middle and end", testNo: 8},
+		{name: "Two Chunk file with chunk swapped", testNo: 11},
+		{name: "Two Chunk file with updated file having no common data", testNo: 15},
+		{name: "Small Chunk with some literals at the end", testNo: 17},
+		{name: "Large Chunk with some literals missing in the middle", testNo: 20},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			inputfile := fmt.Sprintf("testdata/test%d.org", c.testNo)
+			deltafile := fmt.Sprintf("testdata/test%d.v0.delta", c.testNo)
+			expectedUpdatedfile := fmt.Sprintf("testdata/test%d.update", c.testNo)
+
+			outputfile := fmt.Sprintf("testdata/%s.update", uuid.New().String())
+			defer os.Remove(outputfile)
+
+			err := delta.ApplyDelta(inputfile, deltafile, outputfile, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			match, err := util.CompareFileContents(outputfile, expectedUpdatedfile)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !match {
+				t.Fatalf("'%s' Failed : updated file contents do not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+// TestRoundTripManyChunks checks that chunk indices above the legacy 12 bits limit survive generate and apply
+func TestRoundTripManyChunks(t *testing.T) {
+	// 20 MiB gives more than 4096 chunks of the optimal chunk size
+	original := make([]byte, 20<<20)
+	rand.New(rand.NewSource(1)).Read(original)
+
+	updated := make([]byte, 0, len(original)+16)
+	updated = append(updated, original[:len(original)-1000]...)
+	updated = append(updated, []byte("updated literals")...)
+	updated = append(updated, original[len(original)-1000:]...)
+
+	files := testFiles(t, original, updated)
+	defer files.remove()
+
+	err := files.roundTrip()
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+}
+
+func TestRoundTripChunkLens(t *testing.T) {
+	original := make([]byte, 300*1000)
+	rand.New(rand.NewSource(1)).Read(original)
+
+	updated := make([]byte, 0, len(original)+16)
+	updated = append(updated, original[:1000]...)
+	updated = append(updated, []byte("updated literals")...)
+	updated = append(updated, original[1010:len(original)-5000]...)
+
+	cases := []struct {
+		name    string
+		sigOpts *signature.Options
+	}{
+		{name: "Min chunk length", sigOpts: &signature.Options{ChunkLen: signature.MinChunkLen}},
+		{name: "Chunk length not a multiple of 128", sigOpts: &signature.Options{ChunkLen: 1000}},
+		{name: "Chunk length longer than the file", sigOpts: &signature.Options{ChunkLen: 1 << 20}},
+		{name: "rsync heuristic", sigOpts: &signature.Options{ChunkSizeHeuristic: signature.CHUNK_SIZE_RSYNC}},
+		{name: "tiered heuristic", sigOpts: &signature.Options{ChunkSizeHeuristic: signature.CHUNK_SIZE_TIERED}},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			files := testFiles(t, original, updated)
+			defer files.remove()
+			files.sigOpts = c.sigOpts
+
+			err := files.roundTrip()
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+// roundTripFiles contains the files used for generating and applying a delta in tests
+type roundTripFiles struct {
+	original, sig, updated, delta, output string
+	// sigOpts are the options for generating the signature
+	sigOpts *signature.Options
+}
+
+// testFiles writes original and updated contents to temporary files in testdata
+func testFiles(t *testing.T, original, updated []byte) *roundTripFiles {
+	prefix := fmt.Sprintf("testdata/%s", uuid.New().String())
+	files := &roundTripFiles{
+		original: prefix + ".org",
+		sig:      prefix + ".sig",
+		updated:  prefix + ".update",
+		delta:    prefix + ".delta",
+		output:   prefix + ".output",
+	}
+
+	err := os.WriteFile(files.original, original, 0666)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	err = os.WriteFile(files.updated, updated, 0666)
+	if err != nil {
+		files.remove()
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	return files
+}
+
+func (f *roundTripFiles) remove() {
+	for _, file := range []string{f.original, f.sig, f.updated, f.delta, f.output} {
+		os.Remove(file)
+	}
+}
+
+// roundTrip generates signature and delta, applies the delta and compares output with updated file
+func (f *roundTripFiles) roundTrip() error {
+	_, err := signature.GenerateSignature(f.original, f.sig, f.sigOpts)
+	if err != nil {
+		return err
+	}
+	_, err = delta.GenerateDelta(f.original, f.sig, f.updated, f.delta, nil)
+	if err != nil {
+		return err
+	}
+	err = delta.ApplyDelta(f.original, f.delta, f.output, nil)
+	if err != nil {
+		return err
+	}
+
+	match, err := util.CompareFileContents(f.output, f.updated)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return fmt.Errorf("updated file contents do not match")
+	}
+	return nil
+}
+
+func TestRoundTripLargeLiterals(t *testing.T) {
+	cases := []struct {
+		name         string
+		originalSize int
+		updatedSize  int
+		commonSize   int
+	}{
+		{name: "Updated file with no common data", originalSize: 512, updatedSize: 3*delta.MaxLiteralLen + 100},
+		{name: "Updated file with literals exactly of max size", originalSize: 512, updatedSize: delta.MaxLiteralLen},
+		{name: "Updated file with common data at the end", originalSize: 4096, updatedSize: 2*delta.MaxLiteralLen + 1, commonSize: 4096},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			r := rand.New(rand.NewSource(int64(c.updatedSize)))
+			original := make([]byte, c.originalSize)
+			r.Read(original)
+			updated := make([]byte, c.updatedSize-c.commonSize)
+			r.Read(updated)
+			updated = append(updated, original[:c.commonSize]...)
+
+			files := testFiles(t, original, updated)
+			defer files.remove()
+
+			err := files.roundTrip()
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestStdio(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		stdin    string
+		expected string
+		expError error
+	}{
+		// Happy Paths
+		{name: "Delta of signature from stdin to stdout", args: []string{"testdata/test8.org", "-", "testdata/test8.update", "-"}, stdin: "testdata/test8.sig", expected: "testdata/test8.delta", expError: nil},
+		{name: "Delta of updated file from stdin to stdout", args: []string{"testdata/test8.org", "testdata/test8.sig", "-", "-"}, stdin: "testdata/test8.update", expected: "testdata/test8.delta", expError: nil},
+		{name: "Patch from stdin to stdout", args: []string{"testdata/test8.org", "-", "-"}, stdin: "testdata/test8.delta", expected: "testdata/test8.update", expError: nil},
+
+		// Unhappy Paths
+		{name: "Delta of original file from stdin", args: []string{"-", "testdata/test8.sig", "testdata/test8.update", "-"}, stdin: "testdata/test8.org", expError: delta.ErrStdinOriginalFile},
+		{name: "Delta of signature and updated file from stdin", args: []string{"testdata/test8.org", "-", "-", "-"}, stdin: "testdata/test8.sig", expError: delta.ErrStdinReadTwice},
+		{name: "Patch of original file from stdin", args: []string{"-", "testdata/test8.delta", "-"}, stdin: "testdata/test8.org", expError: delta.ErrStdinOriginalFile},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			stdin, err := os.ReadFile(c.stdin)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			// the multi reader hides the size of stdin like a pipe
+			var stdout bytes.Buffer
+			opts := &delta.Options{Stdin: io.MultiReader(bytes.NewReader(stdin)), Stdout: &stdout}
+
+			if len(c.args) == 4 {
+				_, err = delta.GenerateDelta(c.args[0], c.args[1], c.args[2], c.args[3], opts)
+			} else {
+				err = delta.ApplyDelta(c.args[0], c.args[1], c.args[2], opts)
+			}
+			if err != c.expError {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				return
+			}
+
+			expected, err := os.ReadFile(c.expected)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !bytes.Equal(stdout.Bytes(), expected) {
+				t.Fatalf("'%s' Failed : stdout contents do not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	cases := []struct {
+		name      string
+		overwrite bool
+		expError  error
+	}{
+		// Happy Paths
+		{name: "Overwrite existing files", overwrite: true, expError: nil},
+
+		// Unhappy Paths
+		{name: "Existing files", overwrite: false, expError: fs.ErrExist},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			deltafile := filepath.Join("testdata", uuid.New().String()+".delta")
+			defer os.Remove(deltafile)
+			outputfile := filepath.Join("testdata", uuid.New().String()+".update")
+			defer os.Remove(outputfile)
+			for _, name := range []string{deltafile, outputfile} {
+				err := os.WriteFile(name, []byte("existing"), 0600)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+			}
+
+			opts := &delta.Options{Overwrite: c.overwrite}
+			_, err := delta.GenerateDelta("testdata/test8.org", "testdata/test8.sig", "testdata/test8.update", deltafile, opts)
+			if !errors.Is(err, c.expError) {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			err = delta.ApplyDelta("testdata/test8.org", "testdata/test8.delta", outputfile, opts)
+			if !errors.Is(err, c.expError) {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+
+			// replaced files keep their mode
+			expected := map[string]string{deltafile: "testdata/test8.delta", outputfile: "testdata/test8.update"}
+			for name, expectedName := range expected {
+				stats, err := os.Stat(name)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+				if stats.Mode().Perm() != 0600 {
+					t.Fatalf("'%s' Failed : expected mode:%v, got:%v", t.Name(), fs.FileMode(0600), stats.Mode().Perm())
+				}
+
+				expectedData := []byte("existing")
+				if c.overwrite {
+					expectedData, err = os.ReadFile(expectedName)
+					if err != nil {
+						t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+					}
+				}
+				data, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+				if !bytes.Equal(data, expectedData) {
+					t.Fatalf("'%s' Failed : %s contents do not match", t.Name(), name)
+				}
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	cases := []struct {
+		name    string
+		updated string
+		opts    delta.Options
+	}{
+		{name: "Updated file read in order", updated: "testdata/test8.update", opts: delta.Options{}},
+		{name: "Updated file searched by segments", updated: "testdata/test8.update", opts: delta.Options{Jobs: 4}},
+		{name: "Updated file mapped in memory", updated: "testdata/test8.update", opts: delta.Options{Mmap: true}},
+		{name: "Updated file from stdin", updated: "-", opts: delta.Options{Stdin: iotest.HalfReader(mustOpen(t, "testdata/test8.update"))}},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			deltafile := filepath.Join("testdata", uuid.New().String()+".delta")
+			defer os.Remove(deltafile)
+			outputfile := filepath.Join("testdata", uuid.New().String()+".update")
+			defer os.Remove(outputfile)
+
+			opts := c.opts
+			opts.Checksum = signature.STRONG_HASH_BLAKE2B
+			_, err := delta.GenerateDelta("testdata/test8.org", "testdata/test8.sig", c.updated, deltafile, &opts)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			match, err := util.CompareFileContents(deltafile, "testdata/test8.checksum.delta")
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !match {
+				t.Fatalf("'%s' Failed : delta file contents do not match", t.Name())
+			}
+
+			err = delta.ApplyDelta("testdata/test8.org", deltafile, outputfile, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			match, err = util.CompareFileContents(outputfile, "testdata/test8.update")
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !match {
+				t.Fatalf("'%s' Failed : updated file contents do not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func mustOpen(t *testing.T, name string) *os.File {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestGenerateAndApplyChecksum(t *testing.T) {
+	original := make([]byte, 3*delta.MinSegmentLen)
+	rand.New(rand.NewSource(1)).Read(original)
+	updated := append(append(append([]byte(nil), original[:1000]...), "inserted bytes"...), original[1000:]...)
+
+	cases := []struct {
+		name       string
+		checksum   signature.StrongHashType
+		sigOpts    signature.Options
+		jobs       int
+		noOriginal bool
+	}{
+		{name: "BLAKE2b checksums", checksum: signature.STRONG_HASH_BLAKE2B},
+		{name: "SHA-256 checksums", checksum: signature.STRONG_HASH_SHA256},
+		{name: "XXH3 checksums", checksum: signature.STRONG_HASH_XXH3},
+		{name: "Checksums with jobs", checksum: signature.STRONG_HASH_XXH3, jobs: 3},
+		{name: "Checksums of content defined chunks", checksum: signature.STRONG_HASH_BLAKE2B, sigOpts: signature.Options{CDC: &signature.CDCOptions{}}},
+		{name: "Checksum without original", checksum: signature.STRONG_HASH_SHA256, sigOpts: signature.Options{StrongHash: signature.STRONG_HASH_SHA256}, noOriginal: true},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var sigBuf, deltaBuf, outputBuf bytes.Buffer
+			sig, err := signature.Write(&sigBuf, bytes.NewReader(original), &c.sigOpts)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			var basis io.ReaderAt = bytes.NewReader(original)
+			if c.noOriginal {
+				basis = nil
+			}
+			_, err = delta.Generate(&deltaBuf, sig, basis, bytes.NewReader(updated), &delta.Options{Checksum: c.checksum, Jobs: c.jobs})
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			dr, err := delta.NewReader(bytes.NewReader(deltaBuf.Bytes()), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			header := dr.Header()
+			if header.Checksum != c.checksum || (header.OriginalDigest == nil) != c.noOriginal {
+				t.Fatalf("'%s' Failed : unexpected header:%+v", t.Name(), header)
+			}
+
+			err = delta.Apply(&outputBuf, bytes.NewReader(original), bytes.NewReader(deltaBuf.Bytes()), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !bytes.Equal(outputBuf.Bytes(), updated) {
+				t.Fatalf("'%s' Failed : updated contents do not match", t.Name())
+			}
+
+			// a delta with the original checksum is only applied on its original file
+			if !c.noOriginal {
+				other := append([]byte(nil), original...)
+				other[len(other)-1]++
+				err = delta.Apply(io.Discard, bytes.NewReader(other), bytes.NewReader(deltaBuf.Bytes()), nil)
+				if err != delta.ErrOriginalMismatch {
+					t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), delta.ErrOriginalMismatch, err)
+				}
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+
+	t.Run("Unknown checksum", func(t *testing.T) {
+		var sigBuf bytes.Buffer
+		sig, err := signature.Write(&sigBuf, bytes.NewReader(original), nil)
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		_, err = delta.Generate(io.Discard, sig, bytes.NewReader(original), bytes.NewReader(updated), &delta.Options{Checksum: 99})
+		if err != signature.ErrUnknownStrongHash {
+			t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), signature.ErrUnknownStrongHash, err)
+		}
+	})
+}
+
+func TestSignatureChecksum(t *testing.T) {
+	cases := []struct {
+		name     string
+		original string
+		modified bool
+		opts     delta.Options
+		expError error
+	}{
+		// Happy Paths
+		{name: "Original file of the signature", original: "testdata/test8.org", expError: nil},
+		{name: "Original file touched since the signature", original: "testdata/test8.org", modified: true, expError: nil},
+		{name: "Checksum of the delta reused", original: "testdata/test8.org", opts: delta.Options{Checksum: signature.STRONG_HASH_BLAKE2B}, expError: nil},
+		{name: "Original file mapped in memory", original: "testdata/test8.org", opts: delta.Options{Mmap: true}, expError: nil},
+		{name: "Mismatch ignored", original: "testdata/test115.org", opts: delta.Options{IgnoreSignatureMismatch: true}, expError: nil},
+
+		// Unhappy Paths
+		{name: "Original file changed since the signature", original: "testdata/test115.org", opts: delta.Options{Checksum: signature.STRONG_HASH_XXH3}, expError: delta.ErrSignatureMismatch},
+		{name: "Original file changed since the signature with mmap", original: "testdata/test115.org", opts: delta.Options{Mmap: true}, expError: delta.ErrSignatureMismatch},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			original, err := os.ReadFile(c.original)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			// the signature records the modification time of a copy of test8.org
+			originalfile := filepath.Join("testdata", uuid.New().String()+".org")
+			defer os.Remove(originalfile)
+			err = os.WriteFile(originalfile, original, 0644)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			sigfile := filepath.Join("testdata", uuid.New().String()+".sig")
+			defer os.Remove(sigfile)
+			_, err = signature.GenerateSignature("testdata/test8.org", sigfile, &signature.Options{Checksum: signature.STRONG_HASH_BLAKE2B})
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			stats, err := os.Stat("testdata/test8.org")
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			modTime := stats.ModTime()
+			if c.modified {
+				modTime = modTime.Add(time.Hour)
+			}
+			err = os.Chtimes(originalfile, modTime, modTime)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			deltafile := filepath.Join("testdata", uuid.New().String()+".delta")
+			defer os.Remove(deltafile)
+			_, err = delta.GenerateDelta(originalfile, sigfile, "testdata/test8.update", deltafile, &c.opts)
+			if err != c.expError {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
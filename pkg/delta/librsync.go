@@ -0,0 +1,206 @@
+package delta
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/SDkie/rollinghash/pkg/format"
+)
+
+// librsync Delta File Format:
+// 4 bytes - magic RS_DELTA_MAGIC
+// followed by the commands, each starting with 1 byte opcode
+// if end (the last command):
+//	    0x00        - RS_OP_END
+// if literal of 1 to 64 bytes:
+//	    0x01-0x40   - literal size
+// if literal:
+//	    0x41-0x44   - RS_OP_LITERAL_N1 to RS_OP_LITERAL_N8
+//	    1-8 bytes   - literal size
+// if copy:
+//	    0x45-0x54   - RS_OP_COPY_N1_N1 + 4*i + j
+//	    2^i bytes   - offset in the original file
+//	    2^j bytes   - length
+// in case of literal after the opcode and size, literal data is written
+// all the integers are big endian, written in the shortest of 1, 2, 4 or 8 bytes
+//
+// librsync deltas have no chunk length, MATCH records are written as copies of the original file.
+
+// librsync delta opcodes
+const (
+	RS_OP_END        = 0x00
+	RS_OP_LITERAL_1  = 0x01
+	RS_OP_LITERAL_64 = 0x40
+	RS_OP_LITERAL_N1 = 0x41
+	RS_OP_LITERAL_N8 = 0x44
+	RS_OP_COPY_N1_N1 = 0x45
+	RS_OP_COPY_N8_N8 = 0x54
+)
+
+// setFormat sets the format of the delta file written with opts
+// librsync deltas can't record checksums
+func (d *delta) setFormat(opts *Options) error {
+	if opts == nil || opts.Format == format.NATIVE {
+		return nil
+	}
+	if opts.Format != format.LIBRSYNC {
+		err := format.ErrUnknownType
+		d.log.Error(err.Error(), "format", opts.Format)
+		return err
+	}
+	if d.flags&FLAG_CHECKSUM != 0 {
+		err := format.ErrLibrsyncUnsupported
+		d.log.Error(err.Error(), "checksum", d.checksum)
+		return err
+	}
+	d.format = format.LIBRSYNC
+	return nil
+}
+
+// librsyncCmd returns the librsync command of the current command, without the literal data
+func (d *delta) librsyncCmd() []byte {
+	switch d.currCmd {
+	case MATCH:
+		return appendLibrsyncCopy(nil, uint64(d.startChunkIndex)*uint64(d.chunkLen), uint64(d.matchLen))
+	case COPY:
+		offset := d.chunkOffsets[d.startChunkIndex]
+		end := d.chunkOffsets[d.endChunkIndex] + int64(d.chunkLens[d.endChunkIndex])
+		return appendLibrsyncCopy(nil, uint64(offset), uint64(end-offset))
+	default:
+		return appendLibrsyncLiteral(nil, uint64(len(d.literals)))
+	}
+}
+
+// appendLibrsyncCopy appends the librsync copy command of length bytes at offset of the original file
+func appendLibrsyncCopy(data []byte, offset, length uint64) []byte {
+	offsetIdx, lengthIdx := librsyncIntIdx(offset), librsyncIntIdx(length)
+	data = append(data, RS_OP_COPY_N1_N1+byte(4*offsetIdx+lengthIdx))
+	data = appendLibrsyncInt(data, offset, offsetIdx)
+	return appendLibrsyncInt(data, length, lengthIdx)
+}
+
+// appendLibrsyncLiteral appends the librsync literal command of length bytes, without the literal data
+func appendLibrsyncLiteral(data []byte, length uint64) []byte {
+	if length <= RS_OP_LITERAL_64 {
+		return append(data, byte(length))
+	}
+	idx := librsyncIntIdx(length)
+	data = append(data, RS_OP_LITERAL_N1+byte(idx))
+	return appendLibrsyncInt(data, length, idx)
+}
+
+// librsyncIntIdx returns the index of the shortest length of v, 1, 2, 4 or 8 bytes
+func librsyncIntIdx(v uint64) int {
+	switch {
+	case v <= 0xff:
+		return 0
+	case v <= 0xffff:
+		return 1
+	case v <= 0xffffffff:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// appendLibrsyncInt appends v in big endian with the length of idx
+func appendLibrsyncInt(data []byte, v uint64, idx int) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(data, buf[8-1<<idx:]...)
+}
+
+// writeLibrsyncEnd writes the end command at the end of the librsync delta file
+func (d *delta) writeLibrsyncEnd() error {
+	err := d.deltaFile.WriteByte(RS_OP_END)
+	if err != nil {
+		d.log.Error("error writing to delta file", "err", err)
+		return err
+	}
+	return nil
+}
+
+// readLibrsyncHeader reads the magic of the librsync delta file
+// librsync deltas only contain COPY and LITERAL records
+func (dr *Reader) readLibrsyncHeader() error {
+	_, err := io.ReadFull(dr.r, dr.buf[:])
+	if err != nil {
+		dr.log.Error("error reading deltaFile header", "err", err)
+		return ErrInvalidDeltaFile
+	}
+	dr.header.Format = format.LIBRSYNC
+	dr.header.Flags = FLAG_COPY
+	return nil
+}
+
+// readLibrsyncRecord reads the next command from the librsync delta file
+// it returns io.EOF after the end command
+func (dr *Reader) readLibrsyncRecord() (Record, error) {
+	op, err := dr.r.ReadByte()
+	if err != nil {
+		// the end command is missing from a truncated delta
+		dr.log.Error("error reading deltaFile", "err", err)
+		return Record{}, ErrInvalidDeltaFile
+	}
+
+	var r Record
+	switch {
+	case op == RS_OP_END:
+		// the end command is the last one
+		_, err = dr.r.ReadByte()
+		if err != io.EOF {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "cmd", "END")
+			return Record{}, err
+		}
+		dr.done = true
+		return Record{}, io.EOF
+	case op <= RS_OP_LITERAL_64:
+		r = Record{Cmd: LITERAL, Len: uint64(op)}
+	case op <= RS_OP_LITERAL_N8:
+		r.Cmd = LITERAL
+		r.Len, err = dr.readLibrsyncInt(int(op - RS_OP_LITERAL_N1))
+		if err != nil {
+			return Record{}, err
+		}
+	case op <= RS_OP_COPY_N8_N8:
+		idx := int(op - RS_OP_COPY_N1_N1)
+		r.Cmd = COPY
+		r.Offset, err = dr.readLibrsyncInt(idx / 4)
+		if err != nil {
+			return Record{}, err
+		}
+		r.Len, err = dr.readLibrsyncInt(idx % 4)
+		if err != nil {
+			return Record{}, err
+		}
+		if r.Len == 0 {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "offset", r.Offset, "size", r.Len)
+			return Record{}, err
+		}
+	default:
+		err := ErrInvalidDeltaFile
+		dr.log.Error(err.Error(), "opcode", op)
+		return Record{}, err
+	}
+
+	if r.Len > math.MaxInt64 {
+		err := ErrInvalidDeltaFile
+		dr.log.Error(err.Error(), "cmd", r.Cmd, "len", r.Len)
+		return Record{}, err
+	}
+	return r, nil
+}
+
+// readLibrsyncInt reads a big endian integer with the length of idx from the delta file
+func (dr *Reader) readLibrsyncInt(idx int) (uint64, error) {
+	var buf [8]byte
+	_, err := io.ReadFull(dr.r, buf[8-1<<idx:])
+	if err != nil {
+		dr.log.Error("error reading deltaFile", "err", err)
+		return 0, ErrInvalidDeltaFile
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
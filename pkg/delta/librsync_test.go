@@ -0,0 +1,181 @@
+package delta_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/signature"
+	"github.com/SDkie/rollinghash/pkg/util"
+	"github.com/google/uuid"
+)
+
+func TestGenerateLibrsync(t *testing.T) {
+	cases := []struct {
+		name         string
+		originalfile string
+		sigfile      string
+		opts         delta.Options
+		expError     error
+	}{
+		// Happy Paths
+		{name: "Native signature", originalfile: "testdata/test8.org", sigfile: "testdata/test8.sig", expError: nil},
+		{name: "librsync signature", originalfile: "testdata/test8.org", sigfile: "testdata/test8.rdiff.sig", expError: nil},
+		{name: "librsync signature without original file", sigfile: "testdata/test8.rdiff.sig", expError: nil},
+		{name: "Jobs and mmap", originalfile: "testdata/test8.org", sigfile: "testdata/test8.sig", opts: delta.Options{Jobs: 4, Mmap: true}, expError: nil},
+
+		// Unhappy Paths
+		{name: "Checksum", originalfile: "testdata/test8.org", sigfile: "testdata/test8.sig", opts: delta.Options{Checksum: signature.STRONG_HASH_BLAKE2B}, expError: format.ErrLibrsyncUnsupported},
+		{name: "Unknown format", originalfile: "testdata/test8.org", sigfile: "testdata/test8.sig", opts: delta.Options{Format: 9}, expError: format.ErrUnknownType},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			opts := c.opts
+			if opts.Format == format.NATIVE {
+				opts.Format = format.LIBRSYNC
+			}
+			deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+			defer os.Remove(deltafile)
+			outputfile := fmt.Sprintf("testdata/%s.update", uuid.New().String())
+			defer os.Remove(outputfile)
+
+			_, err := delta.GenerateDelta(c.originalfile, c.sigfile, "testdata/test8.update", deltafile, &opts)
+			if !errors.Is(err, c.expError) {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				return
+			}
+
+			match, err := util.CompareFileContents(deltafile, "testdata/test8.rdiff.delta")
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !match {
+				t.Fatalf("'%s' Failed : delta file contents do not match", t.Name())
+			}
+
+			err = delta.ApplyDelta("testdata/test8.org", deltafile, outputfile, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			match, err = util.CompareFileContents(outputfile, "testdata/test8.update")
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !match {
+				t.Fatalf("'%s' Failed : updated file contents do not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestGenerateAndApplyLibrsync(t *testing.T) {
+	for testNo := 1; testNo <= 22; testNo++ {
+		tf := func(t *testing.T) {
+			inputfile := fmt.Sprintf("testdata/test%d.org", testNo)
+			updatedfile := fmt.Sprintf("testdata/test%d.update", testNo)
+
+			sigfile := fmt.Sprintf("testdata/%s.sig", uuid.New().String())
+			defer os.Remove(sigfile)
+			deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+			defer os.Remove(deltafile)
+			outputfile := fmt.Sprintf("testdata/%s.update", uuid.New().String())
+			defer os.Remove(outputfile)
+
+			sigOpts := &signature.Options{Format: format.LIBRSYNC, StrongHash: signature.STRONG_HASH_MD4}
+			_, err := signature.GenerateSignature(inputfile, sigfile, sigOpts)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			_, err = delta.GenerateDelta("", sigfile, updatedfile, deltafile, &delta.Options{Format: format.LIBRSYNC})
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			err = delta.ApplyDelta(inputfile, deltafile, outputfile, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			match, err := util.CompareFileContents(outputfile, updatedfile)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !match {
+				t.Fatalf("'%s' Failed : updated file contents do not match", t.Name())
+			}
+		}
+
+		t.Run(fmt.Sprintf("test%d", testNo), tf)
+	}
+}
+
+// TestGenerateLibrsyncShortChunks uses librsync signatures with chunks shorter than signature.MinChunkLen, as written by rdiff --block-size
+func TestGenerateLibrsyncShortChunks(t *testing.T) {
+	data, err := os.ReadFile("testdata/test8.org")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+
+	for _, chunkLen := range []int{1, 16, 63} {
+		tf := func(t *testing.T) {
+			sigfile := fmt.Sprintf("testdata/%s.sig", uuid.New().String())
+			defer os.Remove(sigfile)
+			deltafile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
+			defer os.Remove(deltafile)
+			outputfile := fmt.Sprintf("testdata/%s.update", uuid.New().String())
+			defer os.Remove(outputfile)
+
+			f, err := os.Create(sigfile)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			defer f.Close()
+			hash, err := rollinghash.New(rollinghash.ROLLSUM)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			header := signature.Signature{Format: format.LIBRSYNC, Flags: signature.FLAG_STRONG_HASH, HashType: rollinghash.ROLLSUM,
+				StrongHash: signature.STRONG_HASH_BLAKE2B, StrongLen: 32, ChunkLen: uint32(chunkLen)}
+			sw := signature.NewWriter(f, &header, nil)
+			for i := 0; i < len(data); i += chunkLen {
+				chunk := data[i:min(i+chunkLen, len(data))]
+				hash.Reset()
+				hash.Write(chunk)
+				err = sw.WriteChunk(signature.Chunk{Hash: hash.Sum32(), StrongHash: signature.STRONG_HASH_BLAKE2B.Sum(chunk)})
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+			}
+			err = sw.Flush()
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			_, err = delta.GenerateDelta("testdata/test8.org", sigfile, "testdata/test8.update", deltafile, &delta.Options{Format: format.LIBRSYNC})
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			err = delta.ApplyDelta("testdata/test8.org", deltafile, outputfile, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			match, err := util.CompareFileContents(outputfile, "testdata/test8.update")
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !match {
+				t.Fatalf("'%s' Failed : updated file contents do not match", t.Name())
+			}
+		}
+
+		t.Run(fmt.Sprintf("%d bytes chunks", chunkLen), tf)
+	}
+}
@@ -0,0 +1,242 @@
+package delta
+
+import (
+	"io"
+	"sync"
+
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+)
+
+// MinSegmentLen is the minimum length of the segments of the updated file searched concurrently
+const MinSegmentLen = 4 << 20
+
+// record is a record collected while searching a segment of the updated file
+type record struct {
+	cmd             CmdType
+	startChunkIndex uint32
+	endChunkIndex   uint32
+	literals        []byte
+	// len is the number of bytes of the updated file covered by the record
+	len int64
+}
+
+// collectRecord appends the current command to the records of the segment
+func (d *delta) collectRecord() {
+	r := record{cmd: d.currCmd}
+	if d.currCmd == LITERAL {
+		r.literals = d.literals
+		r.len = int64(len(d.literals))
+		d.literals = nil
+	} else {
+		r.startChunkIndex = d.startChunkIndex
+		r.endChunkIndex = d.endChunkIndex
+		r.len = d.matchLen
+	}
+	d.records = append(d.records, r)
+}
+
+// searchSegments splits the updated file in segments, searches jobs segments at a time concurrently
+// and writes the records of the segments in order
+//
+// A segment is read up to chunkLen-1 bytes after its end, so chunks crossing the end are found.
+// The records of a segment after its end are dropped, and the records of the next segment
+// covering the same bytes are trimmed.
+func (d *delta) searchSegments(updated io.ReaderAt, size int64, jobs int) error {
+	segmentLen := max(MinSegmentLen, 16*int64(d.chunkLen))
+	segmentLen -= segmentLen % int64(d.chunkLen)
+
+	// pos is the number of bytes of the updated file written to the delta
+	pos := int64(0)
+	for start := int64(0); start < size; start += segmentLen * int64(jobs) {
+		var segments []*delta
+		var wg sync.WaitGroup
+		errs := make([]error, jobs)
+		for i := 0; i < jobs; i++ {
+			segStart := start + int64(i)*segmentLen
+			if segStart >= size {
+				break
+			}
+			segEnd := min(segStart+segmentLen+int64(d.chunkLen)-1, size)
+			segment, err := d.newSegment(io.NewSectionReader(updated, segStart, segEnd-segStart))
+			if err != nil {
+				return err
+			}
+			if d.updatedData != nil {
+				segment.updatedData = d.updatedData[segStart:segEnd]
+			}
+			segments = append(segments, segment)
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = segment.searchSegment()
+			}(i)
+		}
+		wg.Wait()
+
+		for i, segment := range segments {
+			if errs[i] != nil {
+				return errs[i]
+			}
+			d.stats.WeakHashHits += segment.stats.WeakHashHits
+			d.stats.FalsePositives += segment.stats.FalsePositives
+			segStart := start + int64(i)*segmentLen
+			var err error
+			pos, err = d.mergeSegment(segment.records, segStart, min(segStart+segmentLen, size), pos, updated)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newSegment returns a delta searching a segment of the updated file with the hashmap of d
+func (d *delta) newSegment(updated io.Reader) (*delta, error) {
+	hash, err := rollinghash.New(d.hashType)
+	if err != nil {
+		d.log.Error(err.Error())
+		return nil, err
+	}
+
+	return &delta{
+		chunkLen:     d.chunkLen,
+		hashmap:      d.hashmap,
+		hash64:       d.hash64,
+		strongHash:   d.strongHash,
+		strongHashes: d.strongHashes,
+		matchCmd:     d.matchCmd,
+		currCmd:      NO_CMD,
+		hashType:     d.hashType,
+		hash:         hash,
+		segment:      true,
+		original:     d.original,
+		originalData: d.originalData,
+		updated:      updated,
+		log:          d.log,
+		debug:        d.debug,
+	}, nil
+}
+
+// searchSegment searches the chunks in the segment and collects the records
+func (d *delta) searchSegment() error {
+	err := d.searchFixedChunks()
+	if err != nil {
+		return err
+	}
+	if d.currCmd != NO_CMD {
+		d.collectRecord()
+	}
+	return nil
+}
+
+// mergeSegment writes the records of the segment starting at segStart and ending at segEnd
+// pos is the number of bytes of the updated file already written, it returns the new one
+func (d *delta) mergeSegment(records []record, segStart, segEnd, pos int64, updated io.ReaderAt) (int64, error) {
+	recStart := segStart
+	for _, r := range records {
+		recEnd := recStart + r.len
+		// records after the end of the segment are searched again by the next segment
+		if recStart >= segEnd {
+			break
+		}
+		if r.cmd == LITERAL && recEnd > segEnd {
+			r.literals = r.literals[:segEnd-recStart]
+			r.len = segEnd - recStart
+		}
+
+		err := d.mergeRecord(r, recStart, pos, updated)
+		if err != nil {
+			return 0, err
+		}
+		pos = max(pos, recStart+r.len)
+		recStart = recEnd
+	}
+	return pos, nil
+}
+
+// mergeRecord writes the part of the record starting at recStart after pos
+// a chunk crossing pos is written as literals
+func (d *delta) mergeRecord(r record, recStart, pos int64, updated io.ReaderAt) error {
+	recEnd := recStart + r.len
+	if recEnd <= pos {
+		return nil
+	}
+	if recStart >= pos {
+		return d.writeRecord(r)
+	}
+
+	if r.cmd == LITERAL {
+		r.literals = r.literals[pos-recStart:]
+		return d.writeRecord(r)
+	}
+
+	// skip the chunks before pos
+	skipped := (pos - recStart) / int64(d.chunkLen)
+	r.startChunkIndex += uint32(skipped)
+	recStart += skipped * int64(d.chunkLen)
+	r.len = recEnd - recStart
+	if recStart < pos {
+		chunkEnd := min(recStart+int64(d.chunkLen), recEnd)
+		r.len = recEnd - chunkEnd
+		literals := make([]byte, chunkEnd-pos)
+		_, err := updated.ReadAt(literals, pos)
+		if err != nil {
+			d.log.Error("error reading updatedFile", "err", err)
+			return err
+		}
+		err = d.writeRecord(record{cmd: LITERAL, literals: literals})
+		if err != nil {
+			return err
+		}
+		r.startChunkIndex++
+	}
+	if r.startChunkIndex > r.endChunkIndex {
+		return nil
+	}
+	return d.writeRecord(r)
+}
+
+// writeRecord writes the record to the delta file,
+// it is merged with the current command when possible
+func (d *delta) writeRecord(r record) error {
+	if r.cmd == MATCH {
+		if d.currCmd == MATCH && d.endChunkIndex+1 == r.startChunkIndex {
+			d.endChunkIndex = r.endChunkIndex
+			d.matchLen += r.len
+			return nil
+		}
+		if d.currCmd != NO_CMD {
+			err := d.writeToDeltaFile()
+			if err != nil {
+				return err
+			}
+		}
+		d.currCmd = MATCH
+		d.startChunkIndex = r.startChunkIndex
+		d.endChunkIndex = r.endChunkIndex
+		d.matchLen = r.len
+		return nil
+	}
+
+	if d.currCmd == MATCH {
+		err := d.writeToDeltaFile()
+		if err != nil {
+			return err
+		}
+	}
+	d.currCmd = LITERAL
+	literals := r.literals
+	for len(literals) > 0 {
+		if len(d.literals) == MaxLiteralLen {
+			err := d.writeToDeltaFile()
+			if err != nil {
+				return err
+			}
+		}
+		n := min(MaxLiteralLen-len(d.literals), len(literals))
+		d.literals = append(d.literals, literals[:n]...)
+		literals = literals[n:]
+	}
+	return nil
+}
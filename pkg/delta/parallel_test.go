@@ -0,0 +1,92 @@
+package delta_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+func TestGenerateParallel(t *testing.T) {
+	original := make([]byte, 5*delta.MinSegmentLen+777)
+	rand.New(rand.NewSource(1)).Read(original)
+
+	// edits returns a copy of original with the bytes at each offset replaced by s
+	edits := func(s string, offsets ...int) []byte {
+		updated := append([]byte(nil), original...)
+		for _, offset := range offsets {
+			copy(updated[offset:], s)
+		}
+		return updated
+	}
+	inserted := append(append(append([]byte(nil), original[:delta.MinSegmentLen-10]...), "inserted bytes"...), original[delta.MinSegmentLen-10:]...)
+
+	// with repeated chunks, the first match of a segment overlaps the last match of the previous one
+	zeros := make([]byte, 3*delta.MinSegmentLen)
+
+	cases := []struct {
+		name       string
+		original   []byte
+		updated    []byte
+		jobs       int
+		strongHash signature.StrongHashType
+		hash64     bool
+	}{
+		{name: "Same file", updated: original, jobs: 4},
+		{name: "Edits at segment edges", updated: edits("edit", 100, delta.MinSegmentLen-2, 2*delta.MinSegmentLen+5, 4*delta.MinSegmentLen-1000), jobs: 2},
+		{name: "Insertion before segment edge", updated: inserted, jobs: 3},
+		{name: "Insertion with strong hash", updated: inserted, jobs: 8, strongHash: signature.STRONG_HASH_XXH3},
+		{name: "Insertion with 64 bits hashes", updated: inserted, jobs: 4, hash64: true},
+		{name: "Different file", updated: bytes.Repeat([]byte("different"), delta.MinSegmentLen/4), jobs: 2},
+		{name: "Shorter than a segment", updated: original[:1000], jobs: 4},
+		{name: "Overlapping matches", original: zeros, updated: append([]byte("x"), zeros...), jobs: 2},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			original := original
+			if c.original != nil {
+				original = c.original
+			}
+
+			var sigBuf, expectedDelta, deltaBuf, outputBuf bytes.Buffer
+			opts := &signature.Options{StrongHash: c.strongHash}
+			if c.hash64 {
+				opts.Hash = rollinghash.RABINKARP64
+				opts.Hash64 = true
+			}
+			sig, err := signature.Write(&sigBuf, bytes.NewReader(original), opts)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			_, err = delta.Generate(&expectedDelta, sig, bytes.NewReader(original), bytes.NewReader(c.updated), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			_, err = delta.Generate(&deltaBuf, sig, bytes.NewReader(original), bytes.NewReader(c.updated), &delta.Options{Jobs: c.jobs})
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			// each segment edge can add a chunk of literals
+			maxLen := expectedDelta.Len() + (len(c.updated)/delta.MinSegmentLen+1)*int(sig.ChunkLen)
+			if deltaBuf.Len() > maxLen {
+				t.Fatalf("'%s' Failed : delta has %d bytes, sequential delta has %d bytes", t.Name(), deltaBuf.Len(), expectedDelta.Len())
+			}
+
+			err = delta.Apply(&outputBuf, bytes.NewReader(original), &deltaBuf, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if !bytes.Equal(outputBuf.Bytes(), c.updated) {
+				t.Fatalf("'%s' Failed : updated contents do not match", t.Name())
+			}
+		}
+
+		t.Run(fmt.Sprintf("%s with %d jobs", c.name, c.jobs), tf)
+	}
+}
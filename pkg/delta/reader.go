@@ -0,0 +1,346 @@
+package delta
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+// Header contains the header fields of a delta file
+type Header struct {
+	// Format is LIBRSYNC for librsync deltas, they have FLAG_COPY, no version and no chunk length
+	Format  format.Type
+	Version uint16
+	Flags   uint16
+	// ChunkLen is zero for deltas of content defined chunks
+	ChunkLen uint32
+	// Checksum is the strong hash of the checksums, only with FLAG_CHECKSUM
+	Checksum signature.StrongHashType
+	// OriginalSize and OriginalDigest identify the original file, only with FLAG_ORIGINAL_CHECKSUM
+	OriginalSize   uint64
+	OriginalDigest []byte
+}
+
+// Record is a record of a delta file
+type Record struct {
+	Cmd CmdType
+	// StartChunkIndex and EndChunkIndex are the chunks of the original file of a MATCH record
+	StartChunkIndex uint64
+	EndChunkIndex   uint64
+	// Offset is the offset in the original file of a COPY record
+	Offset uint64
+	// Len is the length of the literal data of a LITERAL record, the length of a COPY record
+	// or the size of the updated file of a CHECKSUM record
+	Len uint64
+	// Digest is the strong hash of the updated file of a CHECKSUM record
+	Digest []byte
+}
+
+// Reader reads the records of a delta file one at a time
+// The literal data of a LITERAL record is read with Literals.
+type Reader struct {
+	r        *bufio.Reader
+	header   Header
+	literals io.LimitedReader
+	buf      [4]byte
+	// done is set after the CHECKSUM record, or the end command of librsync deltas
+	done bool
+	log  *slog.Logger
+}
+
+// NewReader reads the header of the delta file from r and returns a Reader for its records
+// Legacy delta files without header and librsync delta files are also supported.
+// Only the Logger of opts is used.
+func NewReader(r io.Reader, opts *Options) (*Reader, error) {
+	dr := &Reader{
+		r:   bufio.NewReader(r),
+		log: opts.logger(),
+	}
+	dr.literals.R = dr.r
+
+	err := dr.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	return dr, nil
+}
+
+// Header returns the header fields of the delta file
+func (dr *Reader) Header() Header {
+	return dr.header
+}
+
+// Next returns the next record of the delta file
+// The literal data of the previous record is skipped if it was not read.
+// It returns io.EOF when there are no more records, deltas with FLAG_CHECKSUM end with the CHECKSUM record.
+func (dr *Reader) Next() (Record, error) {
+	if dr.done {
+		return Record{}, io.EOF
+	}
+	if dr.literals.N > 0 {
+		_, err := io.Copy(io.Discard, &dr.literals)
+		if err != nil || dr.literals.N > 0 {
+			dr.log.Error("error reading deltaFile", "err", err)
+			return Record{}, ErrInvalidDeltaFile
+		}
+	}
+
+	var r Record
+	var err error
+	if dr.header.Format == format.LIBRSYNC {
+		r, err = dr.readLibrsyncRecord()
+	} else if dr.header.Version == DeltaVersionLegacy {
+		r, err = dr.readLegacyRecord()
+	} else {
+		r, err = dr.readRecord()
+	}
+	if err != nil {
+		return Record{}, err
+	}
+
+	if r.Cmd == LITERAL {
+		dr.literals.N = int64(r.Len)
+	}
+	return r, nil
+}
+
+// Literals returns the literal data of the current LITERAL record
+// The data is only valid until the next call of Next,
+// a read returns io.EOF before Len bytes when the delta file is truncated.
+func (dr *Reader) Literals() io.Reader {
+	return &dr.literals
+}
+
+// readHeader reads the header of the delta file
+// delta files without magic are treated as legacy delta files
+func (dr *Reader) readHeader() error {
+	if magic, ok := format.PeekLibrsyncMagic(dr.r); ok && magic == format.RS_DELTA_MAGIC {
+		return dr.readLibrsyncHeader()
+	}
+	header, err := format.ReadHeader(dr.r, format.DeltaMagic)
+	if err != nil {
+		dr.log.Error(ErrInvalidDeltaFile.Error(), "err", err)
+		return ErrInvalidDeltaFile
+	}
+	dr.header.Version = header.Version
+	dr.header.Flags = header.Flags
+	if dr.header.Version > DeltaVersionLatest || dr.header.Flags&^knownFlags != 0 {
+		err := ErrInvalidDeltaFile
+		dr.log.Error(err.Error(), "version", header.Version, "flags", header.Flags)
+		return err
+	}
+
+	_, err = io.ReadFull(dr.r, dr.buf[:])
+	if err != nil {
+		dr.log.Error("error reading deltaFile header", "err", err)
+		return ErrInvalidDeltaFile
+	}
+	dr.header.ChunkLen = binary.BigEndian.Uint32(dr.buf[:])
+
+	// deltas of content defined chunks only contain COPY records and have no chunk length
+	if dr.header.Flags&FLAG_COPY != 0 {
+		if dr.header.ChunkLen != 0 {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "chunkLen", dr.header.ChunkLen, "flags", dr.header.Flags)
+			return err
+		}
+	} else if dr.header.ChunkLen < signature.MinChunkLen || dr.header.ChunkLen > signature.MaxChunkLen {
+		err := ErrInvalidDeltaFile
+		dr.log.Error(err.Error(), "chunkLen", dr.header.ChunkLen)
+		return err
+	}
+	return dr.readChecksumHeader()
+}
+
+// readChecksumHeader reads the checksum fields of the header
+func (dr *Reader) readChecksumHeader() error {
+	if dr.header.Flags&FLAG_CHECKSUM == 0 {
+		if dr.header.Flags&FLAG_ORIGINAL_CHECKSUM != 0 {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "flags", dr.header.Flags)
+			return err
+		}
+		return nil
+	}
+
+	checksum, err := dr.r.ReadByte()
+	if err != nil {
+		dr.log.Error("error reading deltaFile header", "err", err)
+		return ErrInvalidDeltaFile
+	}
+	dr.header.Checksum = signature.StrongHashType(checksum)
+	if dr.header.Checksum.Size() == 0 {
+		err := ErrInvalidDeltaFile
+		dr.log.Error(err.Error(), "checksum", checksum)
+		return err
+	}
+
+	if dr.header.Flags&FLAG_ORIGINAL_CHECKSUM != 0 {
+		dr.header.OriginalSize, err = dr.readUvarint()
+		if err != nil {
+			return err
+		}
+		dr.header.OriginalDigest, err = dr.readDigest()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRecord reads the next record from the delta file
+// it returns io.EOF when there are no more records
+func (dr *Reader) readRecord() (Record, error) {
+	cmd, err := dr.r.ReadByte()
+	if err != nil {
+		// the CHECKSUM record is missing from a truncated delta
+		if err == io.EOF && dr.header.Flags&FLAG_CHECKSUM != 0 {
+			err = ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "cmd", "CHECKSUM")
+			return Record{}, err
+		}
+		if err != io.EOF {
+			dr.log.Error("error reading deltaFile", "err", err)
+		}
+		return Record{}, err
+	}
+
+	r := Record{Cmd: CmdType(cmd)}
+	switch r.Cmd {
+	case MATCH:
+		if dr.header.Flags&FLAG_COPY != 0 {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "cmd", "MATCH", "flags", dr.header.Flags)
+			return Record{}, err
+		}
+		r.StartChunkIndex, err = dr.readUvarint()
+		if err != nil {
+			return Record{}, err
+		}
+		r.EndChunkIndex, err = dr.readUvarint()
+		if err != nil {
+			return Record{}, err
+		}
+		if r.StartChunkIndex > r.EndChunkIndex {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "startChunkIndex", r.StartChunkIndex, "endChunkIndex", r.EndChunkIndex)
+			return Record{}, err
+		}
+	case LITERAL:
+		r.Len, err = dr.readUvarint()
+		if err != nil {
+			return Record{}, err
+		}
+	case COPY:
+		if dr.header.Flags&FLAG_COPY == 0 {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "cmd", "COPY", "flags", dr.header.Flags)
+			return Record{}, err
+		}
+		r.Offset, err = dr.readUvarint()
+		if err != nil {
+			return Record{}, err
+		}
+		r.Len, err = dr.readUvarint()
+		if err != nil {
+			return Record{}, err
+		}
+		if r.Len == 0 {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "offset", r.Offset, "size", r.Len)
+			return Record{}, err
+		}
+	case CHECKSUM:
+		if dr.header.Flags&FLAG_CHECKSUM == 0 {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "cmd", "CHECKSUM", "flags", dr.header.Flags)
+			return Record{}, err
+		}
+		r.Len, err = dr.readUvarint()
+		if err != nil {
+			return Record{}, err
+		}
+		r.Digest, err = dr.readDigest()
+		if err != nil {
+			return Record{}, err
+		}
+		// the CHECKSUM record is the last one
+		_, err = dr.r.ReadByte()
+		if err != io.EOF {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "cmd", "CHECKSUM")
+			return Record{}, err
+		}
+		dr.done = true
+	default:
+		err := ErrInvalidDeltaFile
+		dr.log.Error(err.Error(), "cmd", cmd)
+		return Record{}, err
+	}
+
+	if r.Len > math.MaxInt64 {
+		err := ErrInvalidDeltaFile
+		dr.log.Error(err.Error(), "cmd", r.Cmd, "len", r.Len)
+		return Record{}, err
+	}
+	return r, nil
+}
+
+// readLegacyRecord reads the next 4 bytes record from the legacy delta file
+// it returns io.EOF when there are no more records
+func (dr *Reader) readLegacyRecord() (Record, error) {
+	cmd := dr.buf[:]
+	_, err := io.ReadFull(dr.r, cmd)
+	if err != nil {
+		if err == io.EOF {
+			return Record{}, err
+		}
+		dr.log.Error("error reading deltaFile", "err", err)
+		return Record{}, ErrInvalidDeltaFile
+	}
+
+	r := Record{Cmd: CmdType(cmd[0])}
+	switch r.Cmd {
+	case MATCH:
+		r.StartChunkIndex = uint64(cmd[1])<<4 | uint64(cmd[2])>>4
+		r.EndChunkIndex = uint64(cmd[2]&0x0f)<<8 | uint64(cmd[3])
+		if r.StartChunkIndex > r.EndChunkIndex {
+			err := ErrInvalidDeltaFile
+			dr.log.Error(err.Error(), "startChunkIndex", r.StartChunkIndex, "endChunkIndex", r.EndChunkIndex)
+			return Record{}, err
+		}
+	case LITERAL:
+		r.Len = uint64(cmd[1])<<16 | uint64(cmd[2])<<8 | uint64(cmd[3])
+	default:
+		err := ErrInvalidDeltaFile
+		dr.log.Error(err.Error(), "cmd", cmd[0])
+		return Record{}, err
+	}
+	return r, nil
+}
+
+// readDigest reads a strong hash of the checksum type from the delta file
+func (dr *Reader) readDigest() ([]byte, error) {
+	digest := make([]byte, dr.header.Checksum.Size())
+	_, err := io.ReadFull(dr.r, digest)
+	if err != nil {
+		dr.log.Error("error reading deltaFile", "err", err)
+		return nil, ErrInvalidDeltaFile
+	}
+	return digest, nil
+}
+
+// readUvarint reads a variable length integer from the delta file
+func (dr *Reader) readUvarint() (uint64, error) {
+	n, err := binary.ReadUvarint(dr.r)
+	if err != nil {
+		dr.log.Error("error reading deltaFile", "err", err)
+		return 0, ErrInvalidDeltaFile
+	}
+	return n, nil
+}
@@ -0,0 +1,123 @@
+package delta_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+func TestReader(t *testing.T) {
+	// records of test8, the legacy delta has the same records
+	test8Records := []delta.Record{
+		{Cmd: delta.LITERAL, Len: 5},
+		{Cmd: delta.MATCH, StartChunkIndex: 0, EndChunkIndex: 0},
+		{Cmd: delta.LITERAL, Len: 4},
+		{Cmd: delta.MATCH, StartChunkIndex: 1, EndChunkIndex: 1},
+		{Cmd: delta.LITERAL, Len: 8},
+	}
+	test8Literals := "ABCD\nEFG\nHIJKLMN\n"
+
+	// the checksums are the strong hashes of the whole files
+	original, err := os.ReadFile("testdata/test8.org")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	updated, err := os.ReadFile("testdata/test8.update")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	checksumHeader := delta.Header{Version: delta.DeltaVersion1, Flags: delta.FLAG_CHECKSUM | delta.FLAG_ORIGINAL_CHECKSUM, ChunkLen: 256,
+		Checksum: signature.STRONG_HASH_BLAKE2B, OriginalSize: uint64(len(original)), OriginalDigest: signature.STRONG_HASH_BLAKE2B.Sum(original)}
+	// MATCH records are written as copies of the original file in librsync deltas
+	librsyncRecords := []delta.Record{
+		{Cmd: delta.LITERAL, Len: 5},
+		{Cmd: delta.COPY, Offset: 0, Len: 256},
+		{Cmd: delta.LITERAL, Len: 4},
+		{Cmd: delta.COPY, Offset: 256, Len: 256},
+		{Cmd: delta.LITERAL, Len: 8},
+	}
+	checksumRecords := append(append([]delta.Record(nil), test8Records...),
+		delta.Record{Cmd: delta.CHECKSUM, Len: uint64(len(updated)), Digest: signature.STRONG_HASH_BLAKE2B.Sum(updated)})
+
+	cases := []struct {
+		name        string
+		deltafile   string
+		skip        bool
+		expHeader   delta.Header
+		expRecords  []delta.Record
+		expLiterals string
+		expError    error
+	}{
+		// Happy Paths
+		{name: "Two Chunk file", deltafile: "test8.delta", expHeader: delta.Header{Version: delta.DeltaVersion1, ChunkLen: 256}, expRecords: test8Records, expLiterals: test8Literals, expError: nil},
+		{name: "Legacy Two Chunk file", deltafile: "test8.v0.delta", expHeader: delta.Header{ChunkLen: 256}, expRecords: test8Records, expLiterals: test8Literals, expError: nil},
+		{name: "Literals skipped", deltafile: "test8.delta", skip: true, expHeader: delta.Header{Version: delta.DeltaVersion1, ChunkLen: 256}, expRecords: test8Records, expError: nil},
+		{name: "Two Chunk file with checksums", deltafile: "test8.checksum.delta", expHeader: checksumHeader, expRecords: checksumRecords, expLiterals: test8Literals, expError: nil},
+		{name: "librsync Two Chunk file", deltafile: "test8.rdiff.delta", expHeader: delta.Header{Format: format.LIBRSYNC, Flags: delta.FLAG_COPY}, expRecords: librsyncRecords, expLiterals: test8Literals, expError: nil},
+
+		// Unhappy Paths
+		{name: "Unknown command", deltafile: "test104.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "Truncated literals", deltafile: "test106.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "Unsupported version", deltafile: "test107.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "Signature file", deltafile: "test108.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "Match record in delta with copy records", deltafile: "test110.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "Chunk length below format limit", deltafile: "test111.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "Missing checksum record", deltafile: "test114.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync missing end command", deltafile: "test117.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync unknown opcode", deltafile: "test118.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync data after end command", deltafile: "test119.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync empty copy", deltafile: "test120.delta", expError: delta.ErrInvalidDeltaFile},
+		{name: "librsync truncated copy", deltafile: "test122.delta", expError: delta.ErrInvalidDeltaFile},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + c.deltafile)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			var records []delta.Record
+			var literals bytes.Buffer
+			dr, err := delta.NewReader(bytes.NewReader(data), nil)
+			for err == nil {
+				var r delta.Record
+				r, err = dr.Next()
+				if err != nil {
+					break
+				}
+				records = append(records, r)
+				if r.Cmd == delta.LITERAL && !c.skip {
+					_, err = io.Copy(&literals, dr.Literals())
+				}
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			if err != c.expError {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(dr.Header(), c.expHeader) {
+				t.Fatalf("'%s' Failed : expected header:%+v, got:%+v", t.Name(), c.expHeader, dr.Header())
+			}
+			if !reflect.DeepEqual(records, c.expRecords) {
+				t.Fatalf("'%s' Failed : expected records:%+v, got:%+v", t.Name(), c.expRecords, records)
+			}
+			if literals.String() != c.expLiterals {
+				t.Fatalf("'%s' Failed : expected literals:%q, got:%q", t.Name(), c.expLiterals, literals.String())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
@@ -0,0 +1,60 @@
+package delta
+
+import (
+	"io"
+	"time"
+)
+
+// Stats reports how effective the generation of a delta was
+type Stats struct {
+	// MatchedBytes is the number of bytes of the updated file copied from the original file
+	MatchedBytes uint64
+	// LiteralBytes is the number of bytes of the updated file written as literals
+	LiteralBytes uint64
+	// MatchRecords is the number of MATCH records, or COPY records for content defined chunks
+	MatchRecords uint64
+	// LiteralRecords is the number of LITERAL records
+	LiteralRecords uint64
+	// WeakHashHits is the number of windows whose rolling hash was found in the signature
+	// With concurrent segments, windows crossing a segment edge are searched twice.
+	WeakHashHits uint64
+	// FalsePositives is the number of weak hash hits rejected by the content or strong hash compare
+	FalsePositives uint64
+	// DeltaBytes is the size of the delta file
+	DeltaBytes uint64
+	// Elapsed is the time spent generating the delta, GenerateDelta also counts reading the signature
+	Elapsed time.Duration
+}
+
+// UpdatedBytes returns the size of the updated file
+func (s *Stats) UpdatedBytes() uint64 {
+	return s.MatchedBytes + s.LiteralBytes
+}
+
+// MatchRatio returns the fraction of the updated file copied from the original file
+func (s *Stats) MatchRatio() float64 {
+	if s.UpdatedBytes() == 0 {
+		return 0
+	}
+	return float64(s.MatchedBytes) / float64(s.UpdatedBytes())
+}
+
+// CompressionRatio returns the size of the delta file relative to the size of the updated file
+func (s *Stats) CompressionRatio() float64 {
+	if s.UpdatedBytes() == 0 {
+		return 0
+	}
+	return float64(s.DeltaBytes) / float64(s.UpdatedBytes())
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += uint64(n)
+	return n, err
+}
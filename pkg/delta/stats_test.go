@@ -0,0 +1,120 @@
+package delta_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/delta"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/signature"
+	"github.com/google/uuid"
+)
+
+func TestGenerateDeltaStats(t *testing.T) {
+	deltafile := filepath.Join("testdata", uuid.New().String()+".delta")
+	defer os.Remove(deltafile)
+
+	stats, err := delta.GenerateDelta("testdata/test8.org", "testdata/test8.sig", "testdata/test8.update", deltafile, nil)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+
+	info, err := os.Stat(deltafile)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+	}
+	// test8.update is the two chunks of test8.org with 5, 4 and 8 literals around them
+	expected := delta.Stats{MatchedBytes: 512, LiteralBytes: 17, MatchRecords: 2, LiteralRecords: 3, WeakHashHits: 2, DeltaBytes: uint64(info.Size())}
+	if stats.Elapsed <= 0 {
+		t.Fatalf("'%s' Failed : expected elapsed time, got:%v", t.Name(), stats.Elapsed)
+	}
+	stats.Elapsed = 0
+	if *stats != expected {
+		t.Fatalf("'%s' Failed : expected stats:%+v, got:%+v", t.Name(), expected, *stats)
+	}
+	if stats.UpdatedBytes() != 529 || stats.MatchRatio() != 512.0/529 || stats.CompressionRatio() != float64(info.Size())/529 {
+		t.Fatalf("'%s' Failed : unexpected ratios %v and %v", t.Name(), stats.MatchRatio(), stats.CompressionRatio())
+	}
+}
+
+func TestGenerateStats(t *testing.T) {
+	original := make([]byte, 3*delta.MinSegmentLen)
+	rand.New(rand.NewSource(1)).Read(original)
+	// the bytes are inserted between two chunks, so no chunk is lost
+	inserted := append(append(append([]byte(nil), original[:delta.MinSegmentLen]...), "inserted bytes"...), original[delta.MinSegmentLen:]...)
+
+	// adding 1, -2 and 1 to three bytes in a row keeps both sums of rollsum
+	collision := make([]byte, 256)
+	for i := range collision {
+		collision[i] = byte(10 + i%200)
+	}
+	collided := append([]byte(nil), collision...)
+	collided[100]++
+	collided[101] -= 2
+	collided[102]++
+
+	const chunks = 3 * delta.MinSegmentLen / 4096
+
+	cases := []struct {
+		name       string
+		original   []byte
+		updated    []byte
+		hash       rollinghash.Type
+		strongHash signature.StrongHashType
+		chunkLen   uint32
+		expStats   delta.Stats
+	}{
+		{name: "Same file", original: original, updated: original, chunkLen: 4096,
+			expStats: delta.Stats{MatchedBytes: uint64(len(original)), MatchRecords: 1, WeakHashHits: chunks}},
+		{name: "Insertion", original: original, updated: inserted, chunkLen: 4096,
+			expStats: delta.Stats{MatchedBytes: uint64(len(original)), LiteralBytes: 14, MatchRecords: 2, LiteralRecords: 1, WeakHashHits: chunks}},
+		{name: "Weak hash collision", original: collision, updated: collided, hash: rollinghash.ROLLSUM,
+			expStats: delta.Stats{LiteralBytes: 256, LiteralRecords: 1, WeakHashHits: 1, FalsePositives: 1}},
+		{name: "Weak hash collision with strong hash", original: collision, updated: collided, hash: rollinghash.ROLLSUM, strongHash: signature.STRONG_HASH_SHA256,
+			expStats: delta.Stats{LiteralBytes: 256, LiteralRecords: 1, WeakHashHits: 1, FalsePositives: 1}},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var sigBuf, deltaBuf bytes.Buffer
+			sig, err := signature.Write(&sigBuf, bytes.NewReader(c.original), &signature.Options{Hash: c.hash, StrongHash: c.strongHash, ChunkLen: c.chunkLen})
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			stats, err := delta.Generate(&deltaBuf, sig, bytes.NewReader(c.original), bytes.NewReader(c.updated), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if stats.DeltaBytes != uint64(deltaBuf.Len()) {
+				t.Fatalf("'%s' Failed : expected delta bytes:%d, got:%d", t.Name(), deltaBuf.Len(), stats.DeltaBytes)
+			}
+			got := *stats
+			got.DeltaBytes, got.Elapsed = 0, 0
+			if got != c.expStats {
+				t.Fatalf("'%s' Failed : expected stats:%+v, got:%+v", t.Name(), c.expStats, got)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+
+	// segments searched concurrently search the windows crossing their edges twice
+	t.Run("Insertion with jobs", func(t *testing.T) {
+		var sigBuf, deltaBuf bytes.Buffer
+		sig, err := signature.Write(&sigBuf, bytes.NewReader(original), &signature.Options{ChunkLen: 4096})
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		stats, err := delta.Generate(&deltaBuf, sig, bytes.NewReader(original), bytes.NewReader(inserted), &delta.Options{Jobs: 3})
+		if err != nil {
+			t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+		}
+		if stats.UpdatedBytes() != uint64(len(inserted)) || stats.LiteralBytes != 14 || stats.WeakHashHits < chunks || stats.DeltaBytes != uint64(deltaBuf.Len()) {
+			t.Fatalf("'%s' Failed : unexpected stats:%+v", t.Name(), *stats)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package delta
+
+import "io"
+
+// windowBufLen is the minimum length of the buffer of the rolling window
+const windowBufLen = 1 << 20
+
+// window is the rolling window of the scanner over the updated file
+//
+// The updated file is read in large blocks into buf and the window slides through buf,
+// so advancing it by a byte needs no read call and no allocation.
+// When the window reaches the end of buf, it is moved back to the start of buf.
+type window struct {
+	r   io.Reader
+	buf []byte
+	// the window is buf[start:end], buf[end:filled] is read but not in the window yet
+	start, end, filled int
+	// err is the first error returned by r
+	err error
+}
+
+// newWindow returns a window reading from r for chunks of chunkLen bytes
+func newWindow(r io.Reader, chunkLen uint32) *window {
+	return &window{
+		r:   r,
+		buf: make([]byte, max(windowBufLen, 4*int(chunkLen))),
+	}
+}
+
+// newMappedWindow returns a window over data, which is used without copying it
+func newMappedWindow(data []byte) *window {
+	return &window{
+		buf:    data,
+		filled: len(data),
+		err:    io.EOF,
+	}
+}
+
+// bytes returns the bytes in the window, they are only valid until the window changes
+func (w *window) bytes() []byte {
+	return w.buf[w.start:w.end]
+}
+
+// next replaces the window by the next n bytes of the updated file
+// the window is shorter at the end of the file, it returns io.EOF when the window is empty
+func (w *window) next(n int) error {
+	w.start = w.end
+	w.fill(n)
+	w.end = min(w.start+n, w.filled)
+	if w.end-w.start < n && w.readErr() != io.EOF || w.start == w.end {
+		return w.readErr()
+	}
+	return nil
+}
+
+// roll moves the window by a byte and returns the bytes leaving and entering it
+// it returns io.EOF at the end of the file
+func (w *window) roll() (out, in byte, err error) {
+	w.fill(w.end - w.start + 1)
+	if w.end == w.filled {
+		return 0, 0, w.readErr()
+	}
+	out, in = w.buf[w.start], w.buf[w.end]
+	w.start++
+	w.end++
+	return out, in, nil
+}
+
+// skip removes the first byte from the window
+func (w *window) skip() {
+	w.start++
+}
+
+// clear empties the window
+func (w *window) clear() {
+	w.start = w.end
+}
+
+// fill reads from r until n bytes are available from the start of the window,
+// the end of the file is reached or r returns an error
+func (w *window) fill(n int) {
+	if w.start+n <= w.filled || w.err != nil {
+		return
+	}
+	if w.start+n > len(w.buf) {
+		copy(w.buf, w.buf[w.start:w.filled])
+		w.end -= w.start
+		w.filled -= w.start
+		w.start = 0
+	}
+	for w.start+n > w.filled && w.err == nil {
+		var read int
+		read, w.err = w.r.Read(w.buf[w.filled:])
+		w.filled += read
+	}
+}
+
+// readErr returns the error which stopped reading r, io.EOF at the end of the file
+func (w *window) readErr() error {
+	if w.err == nil {
+		return io.EOF
+	}
+	return w.err
+}
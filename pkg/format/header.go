@@ -0,0 +1,84 @@
+package format
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Header File Format:
+// 4 bytes - magic
+// 2 bytes - format version
+// 2 bytes - feature flags
+//
+// Files written before the header was introduced start directly with the
+// 4 bytes chunk length, they are read as version 0 (legacy) files.
+// Legacy chunk lengths are multiples of 128, so they never collide with a magic.
+
+const (
+	SignatureMagic = "RHSG"
+	DeltaMagic     = "RHDL"
+)
+
+// HeaderLen is the size of the header in bytes
+const HeaderLen = 8
+
+// VersionLegacy is the version of files without header
+const VersionLegacy uint16 = 0
+
+var (
+	ErrUnexpectedMagic = errors.New("unexpected magic in file header")
+	ErrInvalidHeader   = errors.New("invalid file header")
+)
+
+// Header is the common header at the start of signature and delta files
+type Header struct {
+	Magic   string
+	Version uint16
+	Flags   uint16
+}
+
+// Write writes the header to w
+func (h *Header) Write(w io.Writer) error {
+	data := []byte(h.Magic)
+	data = binary.BigEndian.AppendUint16(data, h.Version)
+	data = binary.BigEndian.AppendUint16(data, h.Flags)
+
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadHeader reads the header with the given magic from r
+// If r starts with another known magic, including librsync magics, ErrUnexpectedMagic is returned.
+// If r does not start with any known magic, nothing is consumed and
+// a legacy header with version 0 is returned.
+func ReadHeader(r *bufio.Reader, magic string) (*Header, error) {
+	data, err := r.Peek(len(magic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch string(data) {
+	case magic:
+	case SignatureMagic, DeltaMagic:
+		return nil, ErrUnexpectedMagic
+	default:
+		if len(data) == 4 && isLibrsyncMagic(binary.BigEndian.Uint32(data)) {
+			return nil, ErrUnexpectedMagic
+		}
+		return &Header{Version: VersionLegacy}, nil
+	}
+
+	data = make([]byte, HeaderLen)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	return &Header{
+		Magic:   magic,
+		Version: binary.BigEndian.Uint16(data[4:6]),
+		Flags:   binary.BigEndian.Uint16(data[6:8]),
+	}, nil
+}
@@ -0,0 +1,82 @@
+package format
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// librsync File Format:
+// librsync and rdiff signature and delta files start with a 4 bytes big endian magic,
+// they have no version and flags.
+// Signature files: magic, 4 bytes block length, 4 bytes strong hash length,
+// then the 4 bytes weak hash and the strong hash of each block.
+// Delta files: magic, then the commands, see the delta package.
+
+// librsync magics
+// MD4 and BLAKE2 signatures use the rollsum weak hash, RK signatures use the rabinkarp weak hash
+const (
+	RS_DELTA_MAGIC         uint32 = 0x72730236
+	RS_MD4_SIG_MAGIC       uint32 = 0x72730136
+	RS_BLAKE2_SIG_MAGIC    uint32 = 0x72730137
+	RS_RK_MD4_SIG_MAGIC    uint32 = 0x72730146
+	RS_RK_BLAKE2_SIG_MAGIC uint32 = 0x72730147
+)
+
+var (
+	ErrUnknownType         = errors.New("unknown file format")
+	ErrLibrsyncUnsupported = errors.New("option not supported by the librsync format")
+)
+
+// Type is the format of signature and delta files
+type Type uint8
+
+const (
+	// NATIVE files start with the header of this package
+	NATIVE Type = iota
+	// LIBRSYNC files can be read and written by librsync and rdiff
+	LIBRSYNC
+)
+
+var typeNames = map[Type]string{
+	NATIVE:   "native",
+	LIBRSYNC: "librsync",
+}
+
+// ParseType returns the Type for the given name
+func ParseType(name string) (Type, error) {
+	for t, n := range typeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return NATIVE, fmt.Errorf("%w: %s", ErrUnknownType, name)
+}
+
+func (t Type) String() string {
+	name, ok := typeNames[t]
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+	return name
+}
+
+// PeekLibrsyncMagic returns the librsync magic at the start of r, nothing is consumed
+func PeekLibrsyncMagic(r *bufio.Reader) (uint32, bool) {
+	data, _ := r.Peek(4)
+	if len(data) < 4 {
+		return 0, false
+	}
+	magic := binary.BigEndian.Uint32(data)
+	return magic, isLibrsyncMagic(magic)
+}
+
+// isLibrsyncMagic reports whether magic is a librsync magic
+func isLibrsyncMagic(magic uint32) bool {
+	switch magic {
+	case RS_DELTA_MAGIC, RS_MD4_SIG_MAGIC, RS_BLAKE2_SIG_MAGIC, RS_RK_MD4_SIG_MAGIC, RS_RK_BLAKE2_SIG_MAGIC:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package gearhash
+
+// Gear is the Gear rolling hash of a window of bytes, as used by FastCDC.
+//
+// The hash of the window b[0..n) is G[b[0]]<<(n-1) + G[b[1]]<<(n-2) + ... + G[b[n-1]]
+// where G is a fixed table of random values. Only the last 64 bytes of the window
+// contribute to the hash, older bytes are shifted out.
+// It implements rollinghash.RollingHash.
+type Gear struct {
+	hash uint64
+	n    uint
+}
+
+// The Gear table seed.
+//
+// The table is generated from this seed, changing it changes all the hashes.
+const GEAR_SEED uint64 = 0x6765617268617368
+
+var table = newTable(GEAR_SEED)
+
+// newTable generates the byte table with splitmix64
+func newTable(seed uint64) [256]uint64 {
+	var t [256]uint64
+	for i := range t {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}
+
+// New returns a Gear for an empty window
+func New() *Gear {
+	return &Gear{}
+}
+
+// Reset empties the window
+func (g *Gear) Reset() {
+	g.hash, g.n = 0, 0
+}
+
+// Write appends p to the window
+func (g *Gear) Write(p []byte) (int, error) {
+	for _, b := range p {
+		g.hash = g.hash<<1 + table[b]
+	}
+	g.n += uint(len(p))
+	return len(p), nil
+}
+
+// Roll removes out from the start of the window and appends in to the end
+func (g *Gear) Roll(out, in byte) {
+	g.hash = g.hash<<1 + table[in] - table[out]<<g.n
+}
+
+// RollOut removes out from the start of the window
+func (g *Gear) RollOut(out byte) {
+	g.hash -= table[out] << (g.n - 1)
+	g.n--
+}
+
+// Sum32 returns the high 32 bits of the hash, which depend on the most bytes
+func (g *Gear) Sum32() uint32 {
+	return uint32(g.hash >> 32)
+}
+
+// Sum64 returns the hash of the window
+func (g *Gear) Sum64() uint64 {
+	return g.hash
+}
@@ -53,3 +53,51 @@ func RollOut(hash, pow, old uint32) (uint32, uint32) {
 	hash -= pow * (old + RABINKARP_ADJ)
 	return hash, pow
 }
+
+// The 64 bits RabinKarp seed value.
+const RABINKARP64_SEED uint64 = 1
+
+// The 64 bits RabinKarp multiplier.
+//
+// This is the multiplier of the MMIX LCG by Knuth, which passes the spectral
+// test modular 2^64.
+const RABINKARP64_MULT uint64 = 6364136223846793005
+
+// The 64 bits RabinKarp inverse multiplier.
+//
+// This is the inverse of RABINKARP64_MULT modular 2^64.
+const RABINKARP64_INVM uint64 = 13877824140714322085
+
+// The 64 bits RabinKarp seed adjustment.
+//
+// It's equal to; (RABINKARP64_MULT - 1) * RABINKARP64_SEED
+const RABINKARP64_ADJ uint64 = 6364136223846793004
+
+// Hash64 returns the 64 bits hash and the appropriate multiplicative
+// factor for use in Rabin-Karp algorithm.
+func Hash64(sep []byte) (uint64, uint64) {
+	hash := RABINKARP64_SEED
+	for i := 0; i < len(sep); i++ {
+		hash = hash*RABINKARP64_MULT + uint64(sep[i])
+	}
+	var pow, sq uint64 = 1, RABINKARP64_MULT
+	for i := len(sep); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			pow *= sq
+		}
+		sq *= sq
+	}
+	return hash, pow
+}
+
+// Rotate64 create the new 64 bits hash of the rotated chunk
+func Rotate64(hash, pow, old, new uint64) uint64 {
+	return hash*RABINKARP64_MULT - (old+RABINKARP64_ADJ)*pow + new
+}
+
+// RollOut64 creates new 64 bits hash when we rollout one character
+func RollOut64(hash, pow, old uint64) (uint64, uint64) {
+	pow *= RABINKARP64_INVM
+	hash -= pow * (old + RABINKARP64_ADJ)
+	return hash, pow
+}
@@ -0,0 +1,59 @@
+package rabinkarp_test
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/rabinkarp"
+)
+
+func TestRotate64(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, window := range []int{1, 16, 63, 64, 65, 256, 1024} {
+		tf := func(t *testing.T) {
+			hash, pow := rabinkarp.Hash64(data[:window])
+			for i := 1; i+window <= len(data); i++ {
+				hash = rabinkarp.Rotate64(hash, pow, uint64(data[i-1]), uint64(data[i+window-1]))
+
+				expHash, expPow := rabinkarp.Hash64(data[i : i+window])
+				if hash != expHash || pow != expPow {
+					t.Fatalf("'%s' Failed : rotated hash does not match at offset %d", t.Name(), i)
+				}
+			}
+		}
+
+		t.Run("window "+strconv.Itoa(window), tf)
+	}
+}
+
+func TestRollOut64(t *testing.T) {
+	data := make([]byte, 512)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	hash, pow := rabinkarp.Hash64(data)
+	for i := 1; i <= len(data); i++ {
+		hash, pow = rabinkarp.RollOut64(hash, pow, uint64(data[i-1]))
+
+		expHash, expPow := rabinkarp.Hash64(data[i:])
+		if hash != expHash || pow != expPow {
+			t.Fatalf("'%s' Failed : rolled out hash does not match at offset %d", t.Name(), i)
+		}
+	}
+	if hash != rabinkarp.RABINKARP64_SEED || pow != 1 {
+		t.Fatalf("'%s' Failed : hash of the empty window is %d, expected %d", t.Name(), hash, rabinkarp.RABINKARP64_SEED)
+	}
+}
+
+func TestConstants64(t *testing.T) {
+	// variables wrap around modular 2^64, constants don't
+	mult, invm := rabinkarp.RABINKARP64_MULT, rabinkarp.RABINKARP64_INVM
+	if mult*invm != 1 {
+		t.Fatalf("'%s' Failed : RABINKARP64_INVM is not the inverse of RABINKARP64_MULT", t.Name())
+	}
+	if rabinkarp.RABINKARP64_ADJ != (rabinkarp.RABINKARP64_MULT-1)*rabinkarp.RABINKARP64_SEED {
+		t.Fatalf("'%s' Failed : RABINKARP64_ADJ does not match RABINKARP64_MULT and RABINKARP64_SEED", t.Name())
+	}
+}
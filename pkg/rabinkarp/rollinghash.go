@@ -0,0 +1,99 @@
+package rabinkarp
+
+// RabinKarp is the rolling hash state of a window of bytes.
+// It implements rollinghash.RollingHash.
+type RabinKarp struct {
+	hash uint32
+	pow  uint32
+}
+
+// New returns a RabinKarp for an empty window
+func New() *RabinKarp {
+	r := &RabinKarp{}
+	r.Reset()
+	return r
+}
+
+// Reset empties the window
+func (r *RabinKarp) Reset() {
+	r.hash = RABINKARP_SEED
+	r.pow = 1
+}
+
+// Write appends p to the window
+func (r *RabinKarp) Write(p []byte) (int, error) {
+	for _, b := range p {
+		r.hash = r.hash*RABINKARP_MULT + uint32(b)
+		r.pow *= RABINKARP_MULT
+	}
+	return len(p), nil
+}
+
+// Roll removes out from the start of the window and appends in to the end
+func (r *RabinKarp) Roll(out, in byte) {
+	r.hash = Rotate(r.hash, r.pow, uint32(out), uint32(in))
+}
+
+// RollOut removes out from the start of the window
+func (r *RabinKarp) RollOut(out byte) {
+	r.hash, r.pow = RollOut(r.hash, r.pow, uint32(out))
+}
+
+// Sum32 returns the hash of the window
+func (r *RabinKarp) Sum32() uint32 {
+	return r.hash
+}
+
+// Sum64 returns the hash of the window widened to 64 bits
+func (r *RabinKarp) Sum64() uint64 {
+	return uint64(r.hash)
+}
+
+// RabinKarp64 is the 64 bits rolling hash state of a window of bytes.
+// It implements rollinghash.RollingHash.
+type RabinKarp64 struct {
+	hash uint64
+	pow  uint64
+}
+
+// New64 returns a RabinKarp64 for an empty window
+func New64() *RabinKarp64 {
+	r := &RabinKarp64{}
+	r.Reset()
+	return r
+}
+
+// Reset empties the window
+func (r *RabinKarp64) Reset() {
+	r.hash = RABINKARP64_SEED
+	r.pow = 1
+}
+
+// Write appends p to the window
+func (r *RabinKarp64) Write(p []byte) (int, error) {
+	for _, b := range p {
+		r.hash = r.hash*RABINKARP64_MULT + uint64(b)
+		r.pow *= RABINKARP64_MULT
+	}
+	return len(p), nil
+}
+
+// Roll removes out from the start of the window and appends in to the end
+func (r *RabinKarp64) Roll(out, in byte) {
+	r.hash = Rotate64(r.hash, r.pow, uint64(out), uint64(in))
+}
+
+// RollOut removes out from the start of the window
+func (r *RabinKarp64) RollOut(out byte) {
+	r.hash, r.pow = RollOut64(r.hash, r.pow, uint64(out))
+}
+
+// Sum32 returns the high 32 bits of the hash, which are better mixed than the low bits
+func (r *RabinKarp64) Sum32() uint32 {
+	return uint32(r.hash >> 32)
+}
+
+// Sum64 returns the hash of the window
+func (r *RabinKarp64) Sum64() uint64 {
+	return r.hash
+}
@@ -0,0 +1,88 @@
+package rollinghash
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SDkie/rollinghash/pkg/buzhash"
+	"github.com/SDkie/rollinghash/pkg/gearhash"
+	"github.com/SDkie/rollinghash/pkg/rabinkarp"
+	"github.com/SDkie/rollinghash/pkg/rollsum"
+)
+
+var ErrUnknownType = errors.New("unknown rolling hash")
+
+// RollingHash is a hash of a window of bytes which can be updated
+// in constant time when the window slides by one byte
+type RollingHash interface {
+	// Reset empties the window
+	Reset()
+	// Write appends p to the window
+	Write(p []byte) (int, error)
+	// Roll removes out from the start of the window and appends in to the end
+	Roll(out, in byte)
+	// RollOut removes out from the start of the window
+	RollOut(out byte)
+	// Sum32 returns the 32 bits hash of the window
+	Sum32() uint32
+	// Sum64 returns the 64 bits hash of the window
+	Sum64() uint64
+}
+
+// Type is the rolling hash algorithm, it is recorded in the signature file
+type Type uint8
+
+const (
+	RABINKARP Type = iota
+	ROLLSUM
+	BUZHASH
+	// GEAR only depends on the last 64 bytes of the window, it suits content defined chunk boundaries
+	// As a chunk hash, longer chunks with the same last 64 bytes share a hash and need to be verified.
+	GEAR
+	// RABINKARP64 is the 64 bits variant of RABINKARP, for signatures with 64 bits hashes
+	RABINKARP64
+)
+
+var typeNames = map[Type]string{
+	RABINKARP:   "rabinkarp",
+	ROLLSUM:     "rollsum",
+	BUZHASH:     "buzhash",
+	GEAR:        "gear",
+	RABINKARP64: "rabinkarp64",
+}
+
+// ParseType returns the Type for the given name
+func ParseType(name string) (Type, error) {
+	for t, n := range typeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return RABINKARP, fmt.Errorf("%w: %s", ErrUnknownType, name)
+}
+
+func (t Type) String() string {
+	name, ok := typeNames[t]
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+	return name
+}
+
+// New returns a RollingHash of the given type for an empty window
+func New(t Type) (RollingHash, error) {
+	switch t {
+	case RABINKARP:
+		return rabinkarp.New(), nil
+	case ROLLSUM:
+		return rollsum.New(), nil
+	case BUZHASH:
+		return buzhash.New(), nil
+	case GEAR:
+		return gearhash.New(), nil
+	case RABINKARP64:
+		return rabinkarp.New64(), nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownType, t)
+	}
+}
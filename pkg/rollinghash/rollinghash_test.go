@@ -0,0 +1,76 @@
+package rollinghash_test
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+)
+
+func TestRoll(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, hashType := range []rollinghash.Type{rollinghash.RABINKARP, rollinghash.ROLLSUM, rollinghash.BUZHASH, rollinghash.GEAR, rollinghash.RABINKARP64} {
+		for _, window := range []int{1, 16, 63, 64, 65, 256} {
+			tf := func(t *testing.T) {
+				rolling, _ := rollinghash.New(hashType)
+				full, _ := rollinghash.New(hashType)
+
+				rolling.Write(data[:window])
+				for i := 1; i+window <= len(data); i++ {
+					rolling.Roll(data[i-1], data[i+window-1])
+
+					full.Reset()
+					full.Write(data[i : i+window])
+					if rolling.Sum32() != full.Sum32() || rolling.Sum64() != full.Sum64() {
+						t.Fatalf("'%s' Failed : rolled hash does not match at offset %d", t.Name(), i)
+					}
+				}
+			}
+
+			t.Run(hashType.String()+" window "+strconv.Itoa(window), tf)
+		}
+	}
+}
+
+func TestRollOut(t *testing.T) {
+	data := make([]byte, 256)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	for _, hashType := range []rollinghash.Type{rollinghash.RABINKARP, rollinghash.ROLLSUM, rollinghash.BUZHASH, rollinghash.GEAR, rollinghash.RABINKARP64} {
+		tf := func(t *testing.T) {
+			rolling, _ := rollinghash.New(hashType)
+			full, _ := rollinghash.New(hashType)
+
+			rolling.Write(data)
+			for i := 1; i < len(data); i++ {
+				rolling.RollOut(data[i-1])
+
+				full.Reset()
+				full.Write(data[i:])
+				if rolling.Sum32() != full.Sum32() || rolling.Sum64() != full.Sum64() {
+					t.Fatalf("'%s' Failed : rolled out hash does not match at offset %d", t.Name(), i)
+				}
+			}
+		}
+
+		t.Run(hashType.String(), tf)
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for _, hashType := range []rollinghash.Type{rollinghash.RABINKARP, rollinghash.ROLLSUM, rollinghash.BUZHASH, rollinghash.GEAR, rollinghash.RABINKARP64} {
+		parsed, err := rollinghash.ParseType(hashType.String())
+		if err != nil || parsed != hashType {
+			t.Fatalf("'%s' Failed : expected %s, got %s with error %v", t.Name(), hashType, parsed, err)
+		}
+	}
+
+	_, err := rollinghash.ParseType("md5")
+	if !errors.Is(err, rollinghash.ErrUnknownType) {
+		t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), rollinghash.ErrUnknownType, err)
+	}
+}
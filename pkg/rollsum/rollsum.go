@@ -0,0 +1,60 @@
+package rollsum
+
+// Rollsum is the rsync style rolling checksum, it is compatible with librsync's rollsum.
+//
+// s1 is the sum of the bytes and s2 is the sum of the s1 values,
+// each byte is offset by ROLLSUM_CHAR_OFFSET.
+// It implements rollinghash.RollingHash.
+type Rollsum struct {
+	count uint32
+	s1    uint32
+	s2    uint32
+}
+
+// The Rollsum character offset.
+//
+// It is added to each byte, so runs of zero bytes still change the checksum.
+const ROLLSUM_CHAR_OFFSET uint32 = 31
+
+// New returns a Rollsum for an empty window
+func New() *Rollsum {
+	return &Rollsum{}
+}
+
+// Reset empties the window
+func (r *Rollsum) Reset() {
+	r.count, r.s1, r.s2 = 0, 0, 0
+}
+
+// Write appends p to the window
+func (r *Rollsum) Write(p []byte) (int, error) {
+	for _, b := range p {
+		r.s1 += uint32(b) + ROLLSUM_CHAR_OFFSET
+		r.s2 += r.s1
+	}
+	r.count += uint32(len(p))
+	return len(p), nil
+}
+
+// Roll removes out from the start of the window and appends in to the end
+func (r *Rollsum) Roll(out, in byte) {
+	r.s1 += uint32(in) - uint32(out)
+	r.s2 += r.s1 - r.count*(uint32(out)+ROLLSUM_CHAR_OFFSET)
+}
+
+// RollOut removes out from the start of the window
+func (r *Rollsum) RollOut(out byte) {
+	r.s1 -= uint32(out) + ROLLSUM_CHAR_OFFSET
+	r.s2 -= r.count * (uint32(out) + ROLLSUM_CHAR_OFFSET)
+	r.count--
+}
+
+// Sum32 returns the checksum of the window, s2 and s1 truncated to 16 bits each
+func (r *Rollsum) Sum32() uint32 {
+	return r.s2<<16 | r.s1&0xffff
+}
+
+// Sum64 returns the checksum of the window, s2 and s1 with 32 bits each
+func (r *Rollsum) Sum64() uint64 {
+	return uint64(r.s2)<<32 | uint64(r.s1)
+}
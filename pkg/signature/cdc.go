@@ -0,0 +1,130 @@
+package signature
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+
+	"github.com/SDkie/rollinghash/pkg/gearhash"
+)
+
+// Default content defined chunk lengths, as suggested by the FastCDC paper
+const (
+	DefaultMinChunkLen = 2 * 1024
+	DefaultAvgChunkLen = 8 * 1024
+	DefaultMaxChunkLen = 64 * 1024
+)
+
+// CDCOptions contains the chunk lengths of content defined chunking
+// zero values are replaced by the defaults, AvgChunkLen must be a power of two
+type CDCOptions struct {
+	MinChunkLen uint32
+	AvgChunkLen uint32
+	MaxChunkLen uint32
+}
+
+// withDefaults returns the options with zero values replaced by the defaults
+func (o CDCOptions) withDefaults() CDCOptions {
+	if o.MinChunkLen == 0 {
+		o.MinChunkLen = DefaultMinChunkLen
+	}
+	if o.AvgChunkLen == 0 {
+		o.AvgChunkLen = DefaultAvgChunkLen
+	}
+	if o.MaxChunkLen == 0 {
+		o.MaxChunkLen = DefaultMaxChunkLen
+	}
+	return o
+}
+
+// validCDCChunkLens reports whether the content defined chunk lengths can be used for chunking
+// the lengths must be between MinChunkLen and MaxChunkLen and the average length a power of two,
+// as the masks of the chunker have as many bits as the average length
+func validCDCChunkLens(minLen, avgLen, maxLen uint32) bool {
+	return minLen >= MinChunkLen && minLen <= avgLen && avgLen <= maxLen && maxLen <= MaxChunkLen && bits.OnesCount32(avgLen) == 1
+}
+
+// Chunker splits a stream into content defined chunks with the FastCDC algorithm.
+//
+// A chunk ends where the Gear hash of the last bytes has the masked bits set to zero.
+// A harder mask is used before the average length and an easier one after it,
+// which normalizes the chunk lengths around the average.
+// As boundaries depend only on the content, an insertion or deletion changes
+// only the chunks around it.
+type Chunker struct {
+	r      *bufio.Reader
+	minLen int
+	avgLen int
+	maxLen int
+	maskS  uint64
+	maskL  uint64
+	hash   *gearhash.Gear
+}
+
+// NewChunker returns a Chunker reading from r
+// avgLen must be a power of two, other lengths are rounded down to one for the masks
+func NewChunker(r io.Reader, minLen, avgLen, maxLen uint32) *Chunker {
+	avgBits := bits.Len32(avgLen) - 1
+	return &Chunker{
+		r:      bufio.NewReaderSize(r, int(maxLen)),
+		minLen: int(minLen),
+		avgLen: int(avgLen),
+		maxLen: int(maxLen),
+		maskS:  topBitsMask(avgBits + 1),
+		maskL:  topBitsMask(avgBits - 1),
+		hash:   gearhash.New(),
+	}
+}
+
+// topBitsMask returns a mask of the n most significant bits
+// the high bits of the Gear hash depend on the most bytes
+func topBitsMask(n int) uint64 {
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk, the chunk is only valid until the next call
+// It returns io.EOF when there are no more chunks
+func (c *Chunker) Next() ([]byte, error) {
+	data, err := c.r.Peek(c.maxLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, io.EOF
+	}
+
+	chunk := data[:c.cutPoint(data)]
+	_, err = c.r.Discard(len(chunk))
+	if err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// cutPoint returns the length of the chunk at the start of data
+func (c *Chunker) cutPoint(data []byte) int {
+	if len(data) <= c.minLen {
+		return len(data)
+	}
+
+	normalLen := c.avgLen
+	if len(data) < normalLen {
+		normalLen = len(data)
+	}
+
+	c.hash.Reset()
+	i := c.minLen
+	for ; i < normalLen; i++ {
+		c.hash.Write(data[i : i+1])
+		if c.hash.Sum64()&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < len(data); i++ {
+		c.hash.Write(data[i : i+1])
+		if c.hash.Sum64()&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,145 @@
+package signature_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+func TestChunker(t *testing.T) {
+	cases := []struct {
+		name                   string
+		size                   int
+		minLen, avgLen, maxLen uint32
+	}{
+		{name: "Default chunk lengths", size: 1 << 20, minLen: signature.DefaultMinChunkLen, avgLen: signature.DefaultAvgChunkLen, maxLen: signature.DefaultMaxChunkLen},
+		{name: "Small chunk lengths", size: 64 * 1024, minLen: 64, avgLen: 256, maxLen: 1024},
+		{name: "Input shorter than min", size: 100, minLen: 256, avgLen: 1024, maxLen: 4096},
+		{name: "Equal chunk lengths", size: 10000, minLen: 512, avgLen: 512, maxLen: 512},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			data := make([]byte, c.size)
+			rand.New(rand.NewSource(1)).Read(data)
+
+			chunks := chunkAll(t, data, c.minLen, c.avgLen, c.maxLen)
+			var joined []byte
+			for i, chunk := range chunks {
+				last := i == len(chunks)-1
+				if len(chunk) > int(c.maxLen) || (!last && len(chunk) < int(c.minLen)) {
+					t.Fatalf("'%s' Failed : chunk %d has length %d", t.Name(), i, len(chunk))
+				}
+				joined = append(joined, chunk...)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Fatalf("'%s' Failed : chunks do not match the input", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestChunkerShift(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	shifted := append([]byte("inserted bytes"), data...)
+
+	chunks := chunkAll(t, data, 512, 2048, 8192)
+	shiftedChunks := chunkAll(t, shifted, 512, 2048, 8192)
+
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		seen[string(chunk)] = true
+	}
+	common := 0
+	for _, chunk := range shiftedChunks {
+		if seen[string(chunk)] {
+			common++
+		}
+	}
+	// only the chunks around the insertion should change
+	if common < len(chunks)-2 {
+		t.Fatalf("'%s' Failed : only %d of %d chunks are preserved", t.Name(), common, len(chunks))
+	}
+}
+
+// chunkAll returns copies of all the chunks of data
+func chunkAll(t *testing.T, data []byte, minLen, avgLen, maxLen uint32) [][]byte {
+	var chunks [][]byte
+	chunker := signature.NewChunker(bytes.NewReader(data), minLen, avgLen, maxLen)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+		}
+		chunks = append(chunks, append([]byte(nil), chunk...))
+	}
+}
+
+func TestWriteCDC(t *testing.T) {
+	cases := []struct {
+		name       string
+		cdc        signature.CDCOptions
+		strongHash signature.StrongHashType
+		expError   error
+	}{
+		// Happy Paths
+		{name: "Default chunk lengths", expError: nil},
+		{name: "Small chunk lengths", cdc: signature.CDCOptions{MinChunkLen: 64, AvgChunkLen: 256, MaxChunkLen: 1024}, expError: nil},
+		{name: "With strong hash", strongHash: signature.STRONG_HASH_BLAKE2B, expError: nil},
+
+		// Unhappy Paths
+		{name: "Min longer than avg", cdc: signature.CDCOptions{MinChunkLen: 4096, AvgChunkLen: 1024}, expError: signature.ErrInvalidChunkSize},
+		{name: "Max shorter than avg", cdc: signature.CDCOptions{AvgChunkLen: 8192, MaxChunkLen: 4096}, expError: signature.ErrInvalidChunkSize},
+		{name: "Invalid avg", cdc: signature.CDCOptions{AvgChunkLen: 1000}, expError: signature.ErrInvalidChunkSize},
+		{name: "Avg not a power of two", cdc: signature.CDCOptions{AvgChunkLen: 12 * 1024}, expError: signature.ErrInvalidChunkSize},
+		{name: "Min shorter than MinChunkLen", cdc: signature.CDCOptions{MinChunkLen: 32, AvgChunkLen: 256, MaxChunkLen: 1024}, expError: signature.ErrInvalidChunkSize},
+		{name: "Max longer than MaxChunkLen", cdc: signature.CDCOptions{MaxChunkLen: signature.MaxChunkLen + 1}, expError: signature.ErrInvalidChunkSize},
+	}
+
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			var buf bytes.Buffer
+			cdc := c.cdc
+			sig, err := signature.Write(&buf, bytes.NewReader(data), &signature.Options{StrongHash: c.strongHash, CDC: &cdc})
+			if err != c.expError {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				return
+			}
+			if sig.Flags&signature.FLAG_VARIABLE_CHUNKS == 0 || len(sig.ChunkLens) != int(sig.TotalChunks) {
+				t.Fatalf("'%s' Failed : signature has no chunk lengths", t.Name())
+			}
+			total := 0
+			for _, chunkLen := range sig.ChunkLens {
+				total += int(chunkLen)
+			}
+			if total != len(data) {
+				t.Fatalf("'%s' Failed : expected total length:%d, got:%d", t.Name(), len(data), total)
+			}
+
+			readSig, err := signature.Read(&buf, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+			if !reflect.DeepEqual(sig, readSig) {
+				t.Fatalf("'%s' Failed : signature does not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
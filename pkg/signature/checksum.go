@@ -0,0 +1,62 @@
+package signature
+
+import (
+	"hash"
+	"io"
+	"time"
+
+	"github.com/SDkie/rollinghash/pkg/util"
+)
+
+// checksumLen is the length of the checksum after the chunks, without the strong hash
+const checksumLen = 16
+
+// digest is the strong hash and the size of the whole input file written in parts
+type digest struct {
+	h    hash.Hash
+	size uint64
+}
+
+// newDigest returns an empty digest with the strong hash t
+func newDigest(t StrongHashType) *digest {
+	return &digest{h: t.New()}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.size += uint64(len(p))
+	return d.h.Write(p)
+}
+
+// writeChecksum sets the checksum of the input r in s and writes it after the chunks
+// digest is nil when the chunks were hashed concurrently, r is read once more then
+func writeChecksum(sw *Writer, r io.Reader, d *digest, size int64, s *Signature) error {
+	if d == nil {
+		d = newDigest(s.Checksum)
+		_, err := io.Copy(d, io.NewSectionReader(r.(io.ReaderAt), 0, size))
+		if err != nil {
+			sw.log.Error("error reading input file", "err", err)
+			return err
+		}
+	}
+
+	s.Size = d.size
+	s.ModTime, _ = util.ModTime(r)
+	s.Digest = d.h.Sum(nil)
+	return sw.WriteChecksum(s.Size, s.ModTime, s.Digest)
+}
+
+// unixNano returns t in unix nanoseconds, 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano returns the time of unix nanoseconds, the zero time for 0
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
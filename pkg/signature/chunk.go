@@ -1,12 +1,99 @@
 package signature
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"math"
 )
 
-// getOptimalChunkSize returns the optimal chunk size for a given file size.
+var ErrUnknownChunkSizeHeuristic = errors.New("unknown chunk size heuristic")
+
+// DefaultChunkLen is the chunk length used when the input size is not known in advance
+const DefaultChunkLen = 2048
+
+// Limits of the chunk length declared by the signature file format
+// Short chunks suit files of small records, such as databases, long chunks suit large files.
+const (
+	MinChunkLen = 64
+	MaxChunkLen = 16 * 1024 * 1024
+)
+
+// MaxChunks is the limit of the number of chunks of a signature, they are counted in 32 bits
+// Inputs above 256 GiB have too many chunks of MinChunkLen.
+const MaxChunks = math.MaxUint32
+
+// ChunkSizeHeuristic picks the length of fixed size chunks from the input size
+type ChunkSizeHeuristic uint8
+
+const (
+	// CHUNK_SIZE_SQRT is sqrt(size) rounded down to a multiple of 128, at least 256
+	CHUNK_SIZE_SQRT ChunkSizeHeuristic = iota
+	// CHUNK_SIZE_RSYNC is the block length picked by rsync,
+	// sqrt(size) rounded down to a multiple of 8, between 700 and 128 KiB
+	CHUNK_SIZE_RSYNC
+	// CHUNK_SIZE_TIERED is a fixed length for each tier of input sizes
+	CHUNK_SIZE_TIERED
+)
+
+var chunkSizeHeuristicNames = map[ChunkSizeHeuristic]string{
+	CHUNK_SIZE_SQRT:   "sqrt",
+	CHUNK_SIZE_RSYNC:  "rsync",
+	CHUNK_SIZE_TIERED: "tiered",
+}
+
+// ParseChunkSizeHeuristic returns the ChunkSizeHeuristic for the given name
+func ParseChunkSizeHeuristic(name string) (ChunkSizeHeuristic, error) {
+	for h, n := range chunkSizeHeuristicNames {
+		if n == name {
+			return h, nil
+		}
+	}
+	return CHUNK_SIZE_SQRT, fmt.Errorf("%w: %s", ErrUnknownChunkSizeHeuristic, name)
+}
+
+func (h ChunkSizeHeuristic) String() string {
+	name, ok := chunkSizeHeuristicNames[h]
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", uint8(h))
+	}
+	return name
+}
+
+// chunkTiers are the chunk lengths of CHUNK_SIZE_TIERED for inputs up to maxSize
+var chunkTiers = []struct {
+	maxSize  int64
+	chunkLen uint32
+}{
+	{maxSize: 1 << 20, chunkLen: 512},
+	{maxSize: 64 << 20, chunkLen: 2 * 1024},
+	{maxSize: 1 << 30, chunkLen: 8 * 1024},
+	{maxSize: 16 << 30, chunkLen: 32 * 1024},
+}
+
+// ChunkLen returns the chunk length for an input of filesize bytes
+func (h ChunkSizeHeuristic) ChunkLen(filesize int64) (uint32, error) {
+	switch h {
+	case CHUNK_SIZE_SQRT:
+		return OptimalChunkSize(filesize), nil
+	case CHUNK_SIZE_RSYNC:
+		chunkLen := int64(math.Sqrt(float64(filesize))) &^ 7
+		return uint32(min(max(chunkLen, 700), 128*1024)), nil
+	case CHUNK_SIZE_TIERED:
+		for _, tier := range chunkTiers {
+			if filesize <= tier.maxSize {
+				return tier.chunkLen, nil
+			}
+		}
+		return 128 * 1024, nil
+	default:
+		return 0, fmt.Errorf("%w: %d", ErrUnknownChunkSizeHeuristic, h)
+	}
+}
+
+// OptimalChunkSize returns the optimal chunk size for a given file size.
 // The optimal chunk size is sqrt(filesize) with a 256 min size rounded down to a multiple of 128.
-func getOptimalChunkSize(filesize int64) uint32 {
+func OptimalChunkSize(filesize int64) uint32 {
 	chunkLen := 256
 	if filesize > 256*256 {
 		sqRoot := int(math.Sqrt(float64(filesize)))
@@ -15,3 +102,34 @@ func getOptimalChunkSize(filesize int64) uint32 {
 
 	return uint32(chunkLen)
 }
+
+// validChunkLen reports whether the chunk length is within the limits of the signature file format
+func validChunkLen(chunkLen uint32) bool {
+	return chunkLen >= MinChunkLen && chunkLen <= MaxChunkLen
+}
+
+// validChunkCount reports whether an input of fileSize bytes has at most MaxChunks chunks of at least chunkLen bytes
+func validChunkCount(fileSize int64, chunkLen uint32) bool {
+	return (fileSize-1)/int64(chunkLen) < MaxChunks
+}
+
+// fixedChunker splits a stream into fixed size chunks
+type fixedChunker struct {
+	r     io.Reader
+	chunk []byte
+}
+
+func newFixedChunker(r io.Reader, chunkLen uint32) *fixedChunker {
+	return &fixedChunker{r: r, chunk: make([]byte, chunkLen)}
+}
+
+// Next returns the next chunk, the chunk is only valid until the next call
+// only the last chunk can be shorter than the chunk length
+// It returns io.EOF when there are no more chunks
+func (c *fixedChunker) Next() ([]byte, error) {
+	n, err := io.ReadFull(c.r, c.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return c.chunk[:n], nil
+}
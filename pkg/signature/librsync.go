@@ -0,0 +1,113 @@
+package signature
+
+import (
+	"encoding/binary"
+
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+)
+
+// librsync Signature File Format:
+// 4 bytes - magic, it records the rolling hash and the strong hash
+//	    RS_MD4_SIG_MAGIC       - ROLLSUM and MD4
+//	    RS_BLAKE2_SIG_MAGIC    - ROLLSUM and BLAKE2B
+//	    RS_RK_MD4_SIG_MAGIC    - RABINKARP and MD4
+//	    RS_RK_BLAKE2_SIG_MAGIC - RABINKARP and BLAKE2B
+// 4 bytes - chunk length
+// 4 bytes - strong hash length, the strong hashes are truncated to it
+// followed by each chunk:
+//	    4 bytes - rolling hash
+//	    N bytes - truncated strong hash
+// all the integers are big endian
+
+// librsyncMagics maps the rolling hash and strong hash pairs to their librsync magic
+var librsyncMagics = map[[2]uint8]uint32{
+	{uint8(rollinghash.ROLLSUM), uint8(STRONG_HASH_MD4)}:       format.RS_MD4_SIG_MAGIC,
+	{uint8(rollinghash.ROLLSUM), uint8(STRONG_HASH_BLAKE2B)}:   format.RS_BLAKE2_SIG_MAGIC,
+	{uint8(rollinghash.RABINKARP), uint8(STRONG_HASH_MD4)}:     format.RS_RK_MD4_SIG_MAGIC,
+	{uint8(rollinghash.RABINKARP), uint8(STRONG_HASH_BLAKE2B)}: format.RS_RK_BLAKE2_SIG_MAGIC,
+}
+
+// librsyncMagic returns the librsync magic of the hashes of the signature
+func librsyncMagic(hashType rollinghash.Type, strongHash StrongHashType) (uint32, bool) {
+	magic, ok := librsyncMagics[[2]uint8{uint8(hashType), uint8(strongHash)}]
+	return magic, ok
+}
+
+// setLibrsync sets the fields of a librsync signature generated with opts
+// it returns format.ErrLibrsyncUnsupported for the options librsync can't record
+func setLibrsync(s *Signature, opts *Options) error {
+	if opts.Format != format.LIBRSYNC {
+		return format.ErrUnknownType
+	}
+	_, ok := librsyncMagic(opts.Hash, opts.StrongHash)
+	if !ok || opts.CDC != nil || opts.Hash64 || opts.Checksum != STRONG_HASH_NONE {
+		return format.ErrLibrsyncUnsupported
+	}
+	s.Format = format.LIBRSYNC
+	s.StrongLen = uint32(opts.StrongHash.Size())
+	return nil
+}
+
+// strongLen returns the length of the strong hashes of the signature
+func (s *Signature) strongLen() int {
+	if s.Format == format.LIBRSYNC {
+		return int(s.StrongLen)
+	}
+	return s.StrongHash.Size()
+}
+
+// writeLibrsyncHeader writes the header fields of a librsync signature file
+func (sw *Writer) writeLibrsyncHeader() error {
+	s := &sw.header
+	magic, ok := librsyncMagic(s.HashType, s.StrongHash)
+	if !ok || s.Flags != FLAG_STRONG_HASH || s.StrongLen == 0 || int(s.StrongLen) > s.StrongHash.Size() {
+		return format.ErrLibrsyncUnsupported
+	}
+	data := binary.BigEndian.AppendUint32(nil, magic)
+	data = binary.BigEndian.AppendUint32(data, s.ChunkLen)
+	data = binary.BigEndian.AppendUint32(data, s.StrongLen)
+	_, err := sw.w.Write(data)
+	return err
+}
+
+// readLibrsyncHeader reads the header fields of a librsync signature file
+func (sr *Reader) readLibrsyncHeader() error {
+	s := &sr.header
+	magic, err := sr.readUint32()
+	if err != nil {
+		return err
+	}
+	for hashes, m := range librsyncMagics {
+		if m == magic {
+			s.HashType = rollinghash.Type(hashes[0])
+			s.StrongHash = StrongHashType(hashes[1])
+		}
+	}
+	s.Format = format.LIBRSYNC
+	s.Flags = FLAG_STRONG_HASH
+
+	s.ChunkLen, err = sr.readUint32()
+	if err != nil {
+		return err
+	}
+	// rdiff writes any block length, not only the chunk lengths of native signatures
+	if s.ChunkLen == 0 || s.ChunkLen > MaxChunkLen {
+		err := ErrInvalidChunkSize
+		sr.log.Error(err.Error(), "chunkLen", s.ChunkLen)
+		return err
+	}
+
+	s.StrongLen, err = sr.readUint32()
+	if err != nil {
+		return err
+	}
+	if s.StrongLen == 0 || int(s.StrongLen) > s.StrongHash.Size() {
+		err := ErrInvalidSignatureFile
+		sr.log.Error(err.Error(), "strongLen", s.StrongLen)
+		return err
+	}
+
+	sr.log.Info("signature", "format", s.Format, "hash", s.HashType, "strongHash", s.StrongHash, "chunkLen", s.ChunkLen)
+	return nil
+}
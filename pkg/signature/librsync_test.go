@@ -0,0 +1,165 @@
+package signature_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+func TestWriteLibrsync(t *testing.T) {
+	cases := []struct {
+		name     string
+		sigfile  string
+		opts     signature.Options
+		expError error
+	}{
+		// Happy Paths
+		{name: "rollsum and MD4", sigfile: "testdata/test5.rdiff-md4.sig", opts: signature.Options{Hash: rollinghash.ROLLSUM, StrongHash: signature.STRONG_HASH_MD4}, expError: nil},
+		{name: "rollsum and BLAKE2", sigfile: "testdata/test5.rdiff-blake2.sig", opts: signature.Options{Hash: rollinghash.ROLLSUM, StrongHash: signature.STRONG_HASH_BLAKE2B}, expError: nil},
+		{name: "rabinkarp and MD4", sigfile: "testdata/test5.rdiff-rk-md4.sig", opts: signature.Options{Hash: rollinghash.RABINKARP, StrongHash: signature.STRONG_HASH_MD4}, expError: nil},
+		{name: "rabinkarp and BLAKE2", sigfile: "testdata/test5.rdiff-rk-blake2.sig", opts: signature.Options{Hash: rollinghash.RABINKARP, StrongHash: signature.STRONG_HASH_BLAKE2B}, expError: nil},
+		{name: "rabinkarp and BLAKE2 with jobs", sigfile: "testdata/test5.rdiff-rk-blake2.sig", opts: signature.Options{Hash: rollinghash.RABINKARP, StrongHash: signature.STRONG_HASH_BLAKE2B, Jobs: 4}, expError: nil},
+
+		// Unhappy Paths
+		{name: "No strong hash", opts: signature.Options{Hash: rollinghash.ROLLSUM}, expError: format.ErrLibrsyncUnsupported},
+		{name: "SHA256", opts: signature.Options{Hash: rollinghash.ROLLSUM, StrongHash: signature.STRONG_HASH_SHA256}, expError: format.ErrLibrsyncUnsupported},
+		{name: "buzhash", opts: signature.Options{Hash: rollinghash.BUZHASH, StrongHash: signature.STRONG_HASH_BLAKE2B}, expError: format.ErrLibrsyncUnsupported},
+		{name: "64 bits hashes", opts: signature.Options{Hash: rollinghash.RABINKARP64, StrongHash: signature.STRONG_HASH_BLAKE2B, Hash64: true}, expError: format.ErrLibrsyncUnsupported},
+		{name: "Content defined chunks", opts: signature.Options{StrongHash: signature.STRONG_HASH_BLAKE2B, CDC: &signature.CDCOptions{}}, expError: format.ErrLibrsyncUnsupported},
+		{name: "Checksum", opts: signature.Options{StrongHash: signature.STRONG_HASH_BLAKE2B, Checksum: signature.STRONG_HASH_BLAKE2B}, expError: format.ErrLibrsyncUnsupported},
+		{name: "Unknown format", opts: signature.Options{Format: 9, StrongHash: signature.STRONG_HASH_BLAKE2B}, expError: format.ErrUnknownType},
+	}
+
+	data, err := os.ReadFile("testdata/test5.org")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			opts := c.opts
+			if opts.Format == format.NATIVE {
+				opts.Format = format.LIBRSYNC
+			}
+			opts.ChunkLen = 2048
+
+			var buf bytes.Buffer
+			sig, err := signature.Write(&buf, bytes.NewReader(data), &opts)
+			if !errors.Is(err, c.expError) {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				return
+			}
+
+			expected, err := os.ReadFile(c.sigfile)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+			if !bytes.Equal(buf.Bytes(), expected) {
+				t.Fatalf("'%s' Failed : signature file does not match %s", t.Name(), c.sigfile)
+			}
+
+			readSig, err := signature.ReadSignature(c.sigfile, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+			if !reflect.DeepEqual(sig, readSig) {
+				t.Fatalf("'%s' Failed : signature does not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestReadLibrsyncTruncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/test2.org")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+	hash, err := rollinghash.New(rollinghash.ROLLSUM)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+
+	expSignature := signature.Signature{Format: format.LIBRSYNC, Flags: signature.FLAG_STRONG_HASH, HashType: rollinghash.ROLLSUM,
+		StrongHash: signature.STRONG_HASH_BLAKE2B, StrongLen: 8, ChunkLen: 256, TotalChunks: 2}
+	for _, chunk := range [][]byte{data[:256], data[256:]} {
+		hash.Reset()
+		hash.Write(chunk)
+		expSignature.Hashes = append(expSignature.Hashes, hash.Sum32())
+		expSignature.StrongHashes = append(expSignature.StrongHashes, signature.STRONG_HASH_BLAKE2B.Sum(chunk)[:8])
+	}
+
+	sig, err := signature.ReadSignature("testdata/test2.rdiff-blake2-8.sig", nil)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+	if !reflect.DeepEqual(*sig, expSignature) {
+		t.Fatalf("'%s' Failed : signature does not match", t.Name())
+	}
+
+	// the truncated strong hashes are written back unchanged
+	var buf bytes.Buffer
+	sw := signature.NewWriter(&buf, sig, nil)
+	for i := range sig.Hashes {
+		err = sw.WriteChunk(signature.Chunk{Hash: sig.Hashes[i], StrongHash: sig.StrongHashes[i]})
+		if err != nil {
+			t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+		}
+	}
+	err = sw.Flush()
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+	expected, err := os.ReadFile("testdata/test2.rdiff-blake2-8.sig")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("'%s' Failed : signature file does not match", t.Name())
+	}
+}
+
+func TestReadLibrsyncChunkLen(t *testing.T) {
+	cases := []struct {
+		name     string
+		chunkLen uint32
+		expError error
+	}{
+		// Happy Paths
+		{name: "One byte chunks", chunkLen: 1, expError: nil},
+		{name: "Chunks shorter than MinChunkLen", chunkLen: 16, expError: nil},
+		{name: "MaxChunkLen", chunkLen: signature.MaxChunkLen, expError: nil},
+
+		// Unhappy Paths
+		{name: "Zero chunk length", chunkLen: 0, expError: signature.ErrInvalidChunkSize},
+		{name: "Chunks longer than MaxChunkLen", chunkLen: signature.MaxChunkLen + 1, expError: signature.ErrInvalidChunkSize},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			data := binary.BigEndian.AppendUint32(nil, format.RS_BLAKE2_SIG_MAGIC)
+			data = binary.BigEndian.AppendUint32(data, c.chunkLen)
+			data = binary.BigEndian.AppendUint32(data, 32)
+
+			sr, err := signature.NewReader(bytes.NewReader(data), nil)
+			if !errors.Is(err, c.expError) {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err == nil && sr.Header().ChunkLen != c.chunkLen {
+				t.Fatalf("'%s' Failed : expected chunk length:%d, got:%d", t.Name(), c.chunkLen, sr.Header().ChunkLen)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
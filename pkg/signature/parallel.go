@@ -0,0 +1,113 @@
+package signature
+
+import (
+	"io"
+	"sync"
+
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+)
+
+// parallelBatchChunks is the number of chunks hashed together by a worker
+const parallelBatchChunks = 256
+
+// batch is a range of fixed size chunks hashed by a worker
+type batch struct {
+	offset int64
+	len    int64
+	chunks []Chunk
+	err    error
+	done   chan struct{}
+}
+
+// writeParallel hashes the fixed size chunks of r on jobs workers and writes them to sw in index order
+// the chunks are only kept in s when keepChunks is set
+func writeParallel(sw *Writer, r io.ReaderAt, size int64, s *Signature, jobs int, keepChunks bool) error {
+	batchLen := int64(s.ChunkLen) * parallelBatchChunks
+	work := make(chan *batch)
+	// pending bounds the number of batches kept in memory
+	pending := make(chan *batch, 2*jobs)
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	// on errors the workers finish their batch before r is closed or unmapped by the caller
+	defer wg.Wait()
+	defer close(quit)
+
+	go func() {
+		defer close(work)
+		defer close(pending)
+		for offset := int64(0); offset < size; offset += batchLen {
+			b := &batch{offset: offset, len: min(batchLen, size-offset), done: make(chan struct{})}
+			select {
+			case pending <- b:
+			case <-quit:
+				return
+			}
+			select {
+			case work <- b:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, batchLen)
+			for b := range work {
+				b.hash(r, buf, s)
+				close(b.done)
+			}
+		}()
+	}
+
+	for b := range pending {
+		<-b.done
+		if b.err != nil {
+			sw.log.Error("error reading input file", "err", b.err)
+			return b.err
+		}
+		for _, c := range b.chunks {
+			err := sw.WriteChunk(c)
+			if err != nil {
+				return err
+			}
+			if keepChunks {
+				s.add(c)
+			}
+		}
+	}
+	return nil
+}
+
+// hash reads the chunks of the batch from r into buf and hashes them
+func (b *batch) hash(r io.ReaderAt, buf []byte, s *Signature) {
+	buf = buf[:b.len]
+	n, err := r.ReadAt(buf, b.offset)
+	if n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		b.err = err
+		return
+	}
+
+	rollingHash, err := rollinghash.New(s.HashType)
+	if err != nil {
+		b.err = err
+		return
+	}
+	for len(buf) > 0 {
+		chunk := buf[:min(len(buf), int(s.ChunkLen))]
+		buf = buf[len(chunk):]
+
+		rollingHash.Reset()
+		rollingHash.Write(chunk)
+		c := newChunk(rollingHash, s.Flags)
+		if s.StrongHash != STRONG_HASH_NONE {
+			c.StrongHash = s.StrongHash.Sum(chunk)
+		}
+		b.chunks = append(b.chunks, c)
+	}
+}
@@ -0,0 +1,116 @@
+package signature_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+func TestWriteParallel(t *testing.T) {
+	random := make([]byte, 3<<20+123)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	cases := []struct {
+		name       string
+		testNo     int
+		data       []byte
+		jobs       int
+		hash       rollinghash.Type
+		strongHash signature.StrongHashType
+	}{
+		{name: "One Chunk file", testNo: 1, jobs: 4},
+		{name: "Big Chunk file", testNo: 5, jobs: 4},
+		{name: "Big Chunk file with sha256", testNo: 5, jobs: 2, strongHash: signature.STRONG_HASH_SHA256},
+		{name: "Many batches", data: random, jobs: 8},
+		{name: "Many batches with one job", data: random, jobs: 1},
+		{name: "Many batches with buzhash and xxh3", data: random, jobs: 3, hash: rollinghash.BUZHASH, strongHash: signature.STRONG_HASH_XXH3},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			data := c.data
+			if data == nil {
+				var err error
+				data, err = os.ReadFile(fmt.Sprintf("testdata/test%d.org", c.testNo))
+				if err != nil {
+					t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+				}
+			}
+
+			var expected, buf bytes.Buffer
+			expectedSig, err := signature.Write(&expected, bytes.NewReader(data), &signature.Options{Hash: c.hash, StrongHash: c.strongHash})
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+			sig, err := signature.Write(&buf, bytes.NewReader(data), &signature.Options{Hash: c.hash, StrongHash: c.strongHash, Jobs: c.jobs})
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+				t.Fatalf("'%s' Failed : signature contents do not match", t.Name())
+			}
+			if !reflect.DeepEqual(sig, expectedSig) {
+				t.Fatalf("'%s' Failed : signature does not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+// failingReaderAt fails the read at failAt, the other reads are slow so the workers are still reading on the error
+type failingReaderAt struct {
+	*bytes.Reader
+	failAt int64
+	active atomic.Int32
+	closed bool
+}
+
+var errRead = errors.New("read error")
+
+func (r *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.active.Add(1)
+	defer r.active.Add(-1)
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if off == r.failAt {
+		return 0, errRead
+	}
+	time.Sleep(10 * time.Millisecond)
+	return r.Reader.ReadAt(p, off)
+}
+
+func TestWriteParallelReadError(t *testing.T) {
+	data := make([]byte, 8<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, jobs := range []int{2, 8} {
+		tf := func(t *testing.T) {
+			// the first batch fails, the next ones are being read when the error is returned
+			r := &failingReaderAt{Reader: bytes.NewReader(data), failAt: 0}
+			_, err := signature.Write(io.Discard, r, &signature.Options{ChunkLen: 1024, Jobs: jobs})
+			if !errors.Is(err, errRead) {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), errRead, err)
+			}
+			// the caller closes the input once Write returns, the race detector reports workers still reading it
+			r.closed = true
+			if active := r.active.Load(); active != 0 {
+				t.Fatalf("'%s' Failed : expected no reads after Write returned, got:%d", t.Name(), active)
+			}
+		}
+
+		t.Run(fmt.Sprintf("%d jobs", jobs), tf)
+	}
+}
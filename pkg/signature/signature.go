@@ -1,19 +1,40 @@
 package signature
 
 import (
-	"encoding/binary"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
-	"github.com/SDkie/rollinghash/pkg/rabinkarp"
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
 	"github.com/SDkie/rollinghash/pkg/util"
 )
 
 // Signature File Format:
-// 4 bytes - chunk length
-// 4 bytes - hash for each chunk
+// 4 bytes - magic "RHSG"
+// 2 bytes - format version
+// 2 bytes - flags
+// 1 byte  - rolling hash type
+// 4 bytes - chunk length (average chunk length with FLAG_VARIABLE_CHUNKS)
+// 4 bytes - min chunk length (only with FLAG_VARIABLE_CHUNKS)
+// 4 bytes - max chunk length (only with FLAG_VARIABLE_CHUNKS)
+// 1 byte  - strong hash type (only with FLAG_STRONG_HASH)
+// 1 byte  - strong hash type of the checksum (only with FLAG_CHECKSUM)
+// for each chunk:
+//	    4 bytes - hash (8 bytes with FLAG_HASH64)
+//	    4 bytes - chunk length (only with FLAG_VARIABLE_CHUNKS)
+//	    N bytes - strong hash (only with FLAG_STRONG_HASH)
+// only with FLAG_CHECKSUM, after the chunks:
+//	    8 bytes - size of the input file
+//	    8 bytes - modification time of the input file in unix nanoseconds, 0 when unknown
+//	    N bytes - strong hash of the input file
+//
+// Legacy (version 0) signature files have no magic, version, flags and hash type,
+// they start with the 4 bytes chunk length followed by the hashes.
+//
+// librsync signature files are also read and written, see librsync.go.
 
 var (
 	ErrEmptyInputFile       = errors.New("inputFile is empty")
@@ -21,136 +42,448 @@ var (
 	ErrInvalidChunkSize     = errors.New("invalid chunk size")
 )
 
+// Signature file format versions
+const (
+	SignatureVersionLegacy uint16 = iota
+	SignatureVersion1
+
+	SignatureVersionLatest = SignatureVersion1
+)
+
+// Signature file flags
+const (
+	// FLAG_STRONG_HASH is set when a strong hash is stored for each chunk
+	FLAG_STRONG_HASH uint16 = 1 << iota
+	// FLAG_VARIABLE_CHUNKS is set when the chunks are content defined,
+	// the length is stored for each chunk
+	FLAG_VARIABLE_CHUNKS
+	// FLAG_HASH64 is set when the chunk hashes are 64 bits wide
+	FLAG_HASH64
+	// FLAG_CHECKSUM is set when the size, modification time and strong hash
+	// of the whole input file are stored after the chunks
+	FLAG_CHECKSUM
+
+	knownFlags = FLAG_STRONG_HASH | FLAG_VARIABLE_CHUNKS | FLAG_HASH64 | FLAG_CHECKSUM
+)
+
 // Signature contains all the information stored in a signature file
 type Signature struct {
-	ChunkLen    uint32
-	TotalChunks uint32
-	Hashes      []uint32
+	// Format is LIBRSYNC for librsync signatures, they have FLAG_STRONG_HASH and version 0
+	Format       format.Type
+	Version      uint16
+	Flags        uint16
+	HashType     rollinghash.Type
+	StrongHash   StrongHashType
+	ChunkLen     uint32
+	TotalChunks  uint32
+	Hashes       []uint32
+	StrongHashes [][]byte
+
+	// Only with FLAG_HASH64, Hashes is empty then
+	Hashes64 []uint64
+
+	// Only with FLAG_VARIABLE_CHUNKS
+	MinChunkLen uint32
+	MaxChunkLen uint32
+	ChunkLens   []uint32
+
+	// Only for librsync signatures, the strong hashes are truncated to StrongLen bytes
+	StrongLen uint32
+
+	// Only with FLAG_CHECKSUM, Digest is the strong hash of the whole input file
+	// ModTime is zero when the input was not a regular file
+	Checksum StrongHashType
+	Size     uint64
+	ModTime  time.Time
+	Digest   []byte
+}
+
+// Options contains the options for generating a signature
+// nil Options generates a signature with default options
+type Options struct {
+	// Format LIBRSYNC writes a librsync signature, it needs fixed size chunks, 32 bits ROLLSUM or RABINKARP hashes
+	// and the MD4 or BLAKE2B strong hash, without Checksum
+	Format format.Type
+	// Hash is the rolling hash algorithm used for the chunk hashes
+	Hash rollinghash.Type
+	// StrongHash stores a strong hash of each chunk along with the rolling hash,
+	// so the delta can be generated without the original file
+	StrongHash StrongHashType
+	// Checksum stores the size, the modification time and this strong hash of the whole input file,
+	// so GenerateDelta verifies that the original file is the input of the signature.
+	// STRONG_HASH_NONE stores no checksum.
+	Checksum StrongHashType
+	// Hash64 stores 64 bits chunk hashes, so fewer chunks of the updated file share a hash
+	// with a chunk of the signature by chance. Use it with a 64 bits rolling hash, such as RABINKARP64.
+	Hash64 bool
+	// ChunkLen is the length of fixed size chunks, between MinChunkLen and MaxChunkLen
+	// zero picks the length from the input size with ChunkSizeHeuristic
+	ChunkLen uint32
+	// ChunkSizeHeuristic picks the length of fixed size chunks when ChunkLen is zero,
+	// DefaultChunkLen is used when the input size is not known
+	ChunkSizeHeuristic ChunkSizeHeuristic
+	// CDC splits the input in content defined chunks instead of fixed size chunks,
+	// ChunkLen and ChunkSizeHeuristic are ignored
+	CDC *CDCOptions
+	// Jobs is the number of goroutines hashing fixed size chunks, below 2 the chunks are hashed sequentially.
+	// Chunks are only hashed concurrently when the input size is known and the input is an io.ReaderAt,
+	// the output is the same as the sequential one.
+	Jobs int
+	// Mmap memory maps the input file in GenerateSignature,
+	// files which can't be mapped are read instead
+	Mmap bool
+	// Overwrite replaces an existing signature file in GenerateSignature
+	Overwrite bool
+	// Stdin is read for the file name "-" in GenerateSignature and ReadSignature, nil reads os.Stdin
+	Stdin io.Reader
+	// Stdout receives the signature file name "-" in GenerateSignature, nil writes to os.Stdout
+	Stdout io.Writer
+	// Logger receives the logs, nil logs nothing
+	// It is also used when reading signatures.
+	Logger *slog.Logger
+}
+
+// logger returns the logger of the options
+func (o *Options) logger() *slog.Logger {
+	if o == nil {
+		return util.Logger(nil)
+	}
+	return util.Logger(o.Logger)
+}
+
+// stdin returns the reader of the file name "-"
+func (o *Options) stdin() io.Reader {
+	if o == nil {
+		return util.Stdin(nil)
+	}
+	return util.Stdin(o.Stdin)
+}
+
+// stdout returns the writer of the file name "-"
+func (o *Options) stdout() io.Writer {
+	if o == nil {
+		return util.Stdout(nil)
+	}
+	return util.Stdout(o.Stdout)
 }
 
 // GenerateSignature generates a signature file for a given input file.
-func GenerateSignature(inputFileName, sigFileName string) (*Signature, error) {
-	var signature Signature
+// The chunks are streamed to the signature file,
+// the returned Signature only contains the header fields and TotalChunks.
+// The input file name "-" reads stdin and the signature file name "-" writes to stdout.
+// The signature file is written to a temporary file renamed to sigFileName on success,
+// so a failure leaves no partial signature file.
+func GenerateSignature(inputFileName, sigFileName string, opts *Options) (*Signature, error) {
+	logger := opts.logger()
 
 	// Input file
-	infile, err := os.Open(inputFileName)
+	var input io.Reader = opts.stdin()
+	if inputFileName != util.StdioName {
+		infile, err := os.Open(inputFileName)
+		if err != nil {
+			logger.Error("error opening input file", "err", err)
+			return nil, err
+		}
+		defer infile.Close()
+		stats, err := infile.Stat()
+		if err != nil {
+			logger.Error("error getting file stats", "err", err)
+			return nil, err
+		}
+		if util.IsEmpty(stats) {
+			err := ErrEmptyInputFile
+			logger.Error(err.Error())
+			return nil, err
+		}
+
+		input = infile
+		if opts != nil && opts.Mmap {
+			m, err := util.Mmap(infile)
+			if err != nil {
+				logger.Info("reading input file instead of mapping it", "err", err)
+			} else {
+				defer m.Close()
+				input = m
+			}
+		}
+	}
+
+	// Signature file
+	sigfile := opts.stdout()
+	var atomicFile *util.AtomicFile
+	if sigFileName != util.StdioName {
+		f, err := util.CreateAtomic(sigFileName, opts != nil && opts.Overwrite)
+		if err != nil {
+			logger.Error("error creating signature file", "err", err)
+			return nil, err
+		}
+		defer f.Close()
+		sigfile, atomicFile = f, f
+	}
+
+	signature, err := write(sigfile, input, opts, false)
 	if err != nil {
-		log.Printf("error opening input file: %s", err)
 		return nil, err
 	}
-	defer infile.Close()
-	stats, err := infile.Stat()
-	if err != nil {
-		log.Printf("error getting file stats: %s", err)
+	if atomicFile != nil {
+		err = atomicFile.Commit()
+		if err != nil {
+			logger.Error("error writing signature file", "err", err)
+			return nil, err
+		}
+	}
+	return signature, nil
+}
+
+// Write generates the signature of the input read from r and writes it to w.
+// Without Options.ChunkLen, the chunk length is derived from the input size when r reports it
+// (*os.File, *bytes.Reader, ...), otherwise DefaultChunkLen is used.
+// The returned Signature contains all the chunks, GenerateSignature only streams them.
+// With Options.Checksum, the modification time is only recorded when r is a regular file (*os.File).
+func Write(w io.Writer, r io.Reader, opts *Options) (*Signature, error) {
+	return write(w, r, opts, true)
+}
+
+// write generates the signature of the input read from r and writes it to w with a Writer
+// the chunks are only kept in the returned Signature when keepChunks is set
+func write(w io.Writer, r io.Reader, opts *Options, keepChunks bool) (*Signature, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	logger := opts.logger()
+	if opts.StrongHash.Size() == 0 && opts.StrongHash != STRONG_HASH_NONE {
+		err := ErrUnknownStrongHash
+		logger.Error(err.Error())
 		return nil, err
 	}
-	fileSize := stats.Size()
-	if fileSize == 0 {
-		err := ErrEmptyInputFile
-		log.Println(err)
+	if opts.Checksum.Size() == 0 && opts.Checksum != STRONG_HASH_NONE {
+		err := ErrUnknownStrongHash
+		logger.Error(err.Error(), "checksum", opts.Checksum)
 		return nil, err
 	}
 
-	signature.ChunkLen = getOptimalChunkSize(fileSize)
-
-	log.Printf("File size: %d", fileSize)
-	log.Printf("Chunk size: %d", signature.ChunkLen)
+	rollingHash, err := rollinghash.New(opts.Hash)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
 
-	chunk := make([]byte, signature.ChunkLen)
-	for i := 0; ; i++ {
-		n, err := infile.Read(chunk)
+	var signature Signature
+	signature.HashType = opts.Hash
+	signature.StrongHash = opts.StrongHash
+	if signature.StrongHash != STRONG_HASH_NONE {
+		signature.Flags |= FLAG_STRONG_HASH
+	}
+	if opts.Hash64 {
+		signature.Flags |= FLAG_HASH64
+	}
+	signature.Checksum = opts.Checksum
+	if signature.Checksum != STRONG_HASH_NONE {
+		signature.Flags |= FLAG_CHECKSUM
+	}
+	if opts.Format != format.NATIVE {
+		err := setLibrsync(&signature, opts)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Printf("error reading file: %s", err)
+			logger.Error(err.Error(), "format", opts.Format)
 			return nil, err
 		}
-		chunk = chunk[:n]
+	}
 
-		hash, _ := rabinkarp.Hash(chunk)
-		signature.Hashes = append(signature.Hashes, hash)
-		log.Printf("Chunk %d: Hash: %08x", i, hash)
+	fileSize, ok := util.Size(r)
+	if ok {
+		if fileSize == 0 {
+			err := ErrEmptyInputFile
+			logger.Error(err.Error())
+			return nil, err
+		}
+		logger.Info("input", "size", fileSize)
 	}
 
-	err = signature.write(sigFileName)
-	return &signature, err
-}
+	readerAt, isReaderAt := r.(io.ReaderAt)
+	parallel := opts.Jobs > 1 && opts.CDC == nil && ok && isReaderAt
+	input := r
+	var digest *digest
+	if signature.Flags&FLAG_CHECKSUM != 0 && !parallel {
+		// the input is hashed while it is chunked
+		digest = newDigest(signature.Checksum)
+		input = io.TeeReader(r, digest)
+	}
 
-// write creates the signature file and writes the signature to it
-func (s *Signature) write(filename string) error {
-	sigfile, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	var chunker interface{ Next() ([]byte, error) }
+	if opts.CDC != nil {
+		cdc := opts.CDC.withDefaults()
+		if !validCDCChunkLens(cdc.MinChunkLen, cdc.AvgChunkLen, cdc.MaxChunkLen) {
+			err := ErrInvalidChunkSize
+			logger.Error(err.Error())
+			return nil, err
+		}
+		// the chunks are at least MinChunkLen long, except the last one
+		if ok && !validChunkCount(fileSize, cdc.MinChunkLen) {
+			err := ErrInvalidChunkSize
+			logger.Error(err.Error(), "size", fileSize, "minChunkLen", cdc.MinChunkLen)
+			return nil, err
+		}
+		signature.Flags |= FLAG_VARIABLE_CHUNKS
+		signature.ChunkLen = cdc.AvgChunkLen
+		signature.MinChunkLen = cdc.MinChunkLen
+		signature.MaxChunkLen = cdc.MaxChunkLen
+		chunker = NewChunker(input, cdc.MinChunkLen, cdc.AvgChunkLen, cdc.MaxChunkLen)
+	} else {
+		signature.ChunkLen, err = fixedChunkLen(opts, fileSize, ok)
+		if err != nil {
+			logger.Error(err.Error(), "chunkLen", opts.ChunkLen)
+			return nil, err
+		}
+		if ok && !validChunkCount(fileSize, signature.ChunkLen) {
+			err := ErrInvalidChunkSize
+			logger.Error(err.Error(), "size", fileSize, "chunkLen", signature.ChunkLen)
+			return nil, err
+		}
+		chunker = newFixedChunker(input, signature.ChunkLen)
+	}
+	logger.Info("chunking", "chunkLen", signature.ChunkLen, "cdc", opts.CDC != nil)
+
+	sw := NewWriter(w, &signature, opts)
+	if parallel {
+		logger.Info("hashing concurrently", "jobs", opts.Jobs)
+		err = writeParallel(sw, readerAt, fileSize, &signature, opts.Jobs, keepChunks)
+	} else {
+		err = writeSequential(sw, chunker, rollingHash, &signature, keepChunks)
+	}
 	if err != nil {
-		log.Printf("error creating signature file: %s", err)
-		return err
+		return nil, err
 	}
-	defer sigfile.Close()
 
-	err = util.WriteUint32InHex(sigfile, s.ChunkLen)
+	if signature.Flags&FLAG_CHECKSUM != 0 {
+		err = writeChecksum(sw, r, digest, fileSize, &signature)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = sw.Flush()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if signature.Format == format.NATIVE {
+		signature.Version = SignatureVersionLatest
+	}
+	signature.TotalChunks = sw.TotalChunks()
+	return &signature, nil
+}
+
+// fixedChunkLen returns the length of fixed size chunks of the options for an input of fileSize bytes
+// the size is only used when sized is set
+func fixedChunkLen(opts *Options, fileSize int64, sized bool) (uint32, error) {
+	if opts.ChunkLen != 0 {
+		if !validChunkLen(opts.ChunkLen) {
+			return 0, ErrInvalidChunkSize
+		}
+		return opts.ChunkLen, nil
 	}
+	if !sized {
+		return DefaultChunkLen, nil
+	}
+	return opts.ChunkSizeHeuristic.ChunkLen(fileSize)
+}
 
-	for _, hash := range s.Hashes {
-		err = util.WriteUint32InHex(sigfile, hash)
+// writeSequential hashes the chunks returned by chunker and writes them to sw
+// the chunks are only kept in s when keepChunks is set
+func writeSequential(sw *Writer, chunker interface{ Next() ([]byte, error) }, rollingHash rollinghash.RollingHash, s *Signature, keepChunks bool) error {
+	for {
+		chunk, err := chunker.Next()
 		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			sw.log.Error("error reading input file", "err", err)
 			return err
 		}
-	}
 
-	return nil
+		rollingHash.Reset()
+		rollingHash.Write(chunk)
+		c := newChunk(rollingHash, s.Flags)
+		if s.Flags&FLAG_VARIABLE_CHUNKS != 0 {
+			c.Len = uint32(len(chunk))
+		}
+		if s.StrongHash != STRONG_HASH_NONE {
+			c.StrongHash = s.StrongHash.Sum(chunk)
+		}
+		err = sw.WriteChunk(c)
+		if err != nil {
+			return err
+		}
+
+		if keepChunks {
+			s.add(c)
+		}
+	}
 }
 
-// ReadSignature reads a signature file and returns a Signature struct.
-func ReadSignature(sigFileName string) (*Signature, error) {
-	sigfile, err := os.Open(sigFileName)
-	if err != nil {
-		log.Printf("error opening signature File: %s", err)
-		return nil, err
+// newChunk returns a chunk with the hash of the window of h, the 64 bits hash with FLAG_HASH64
+func newChunk(h rollinghash.RollingHash, flags uint16) Chunk {
+	if flags&FLAG_HASH64 != 0 {
+		return Chunk{Hash64: h.Sum64()}
 	}
-	defer sigfile.Close()
+	return Chunk{Hash: h.Sum32()}
+}
 
-	stats, err := sigfile.Stat()
-	if err != nil {
-		log.Printf("error getting file stats: %s", err)
-		return nil, err
+// add appends the chunk to the chunks of the signature
+func (s *Signature) add(c Chunk) {
+	if s.Flags&FLAG_HASH64 != 0 {
+		s.Hashes64 = append(s.Hashes64, c.Hash64)
+	} else {
+		s.Hashes = append(s.Hashes, c.Hash)
 	}
-	if stats.Size() < 8 || stats.Size()%4 != 0 {
-		err := ErrInvalidSignatureFile
-		log.Println(err)
-		return nil, err
+	if s.Flags&FLAG_VARIABLE_CHUNKS != 0 {
+		s.ChunkLens = append(s.ChunkLens, c.Len)
 	}
+	if s.Flags&FLAG_STRONG_HASH != 0 {
+		s.StrongHashes = append(s.StrongHashes, c.StrongHash)
+	}
+}
 
-	var signature Signature
-	data := make([]byte, 4)
+// ReadSignature reads a signature file and returns a Signature struct.
+// Legacy signature files without header are also supported.
+// The file name "-" reads stdin, only the Logger and Stdin of opts are used.
+func ReadSignature(sigFileName string, opts *Options) (*Signature, error) {
+	if sigFileName == util.StdioName {
+		return Read(opts.stdin(), opts)
+	}
 
-	_, err = sigfile.Read(data)
+	logger := opts.logger()
+	sigfile, err := os.Open(sigFileName)
 	if err != nil {
-		log.Printf("error reading signature file: %s", err)
+		logger.Error("error opening signature file", "err", err)
 		return nil, err
 	}
+	defer sigfile.Close()
+
+	return Read(sigfile, opts)
+}
 
-	signature.ChunkLen = binary.BigEndian.Uint32(data)
-	if signature.ChunkLen < 256 || signature.ChunkLen%128 != 0 {
-		err := ErrInvalidChunkSize
-		log.Println(err)
+// Read reads a signature from r and returns a Signature struct with all the chunks.
+// Only the Logger of opts is used, use NewReader to read the chunks one at a time.
+func Read(sigfile io.Reader, opts *Options) (*Signature, error) {
+	sr, err := NewReader(sigfile, opts)
+	if err != nil {
 		return nil, err
 	}
 
-	signature.TotalChunks = uint32(stats.Size()/4) - 1
-	log.Printf("ChunkLen: %d", signature.ChunkLen)
-	log.Printf("TotalChunks: %d", signature.TotalChunks)
-
-	for i := uint32(0); i < signature.TotalChunks; i++ {
-		_, err = sigfile.Read(data)
+	signature := sr.Header()
+	for {
+		c, err := sr.Next()
 		if err != nil {
-			log.Printf("error reading file: %s", err)
+			if err == io.EOF {
+				break
+			}
 			return nil, err
 		}
-		hash := binary.BigEndian.Uint32(data)
-		signature.Hashes = append(signature.Hashes, hash)
-		log.Printf("Chunk %d: Hash: %08x", i, hash)
+		signature.add(c)
 	}
-
-	return &signature, nil
+	// the checksum follows the chunks
+	header := sr.Header()
+	signature.Size, signature.ModTime, signature.Digest = header.Size, header.ModTime, header.Digest
+	signature.TotalChunks = uint32(len(signature.Hashes) + len(signature.Hashes64))
+	return signature, nil
 }
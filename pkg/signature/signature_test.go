@@ -1,11 +1,16 @@
 package signature_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
 	"github.com/SDkie/rollinghash/pkg/signature"
 	"github.com/SDkie/rollinghash/pkg/util"
 	"github.com/google/uuid"
@@ -14,12 +19,23 @@ import (
 // TestFiles format
 // TestX.org : Input file
 // TestX.sig : Signature file
+// TestX.v0.sig : Legacy (version 0) signature file
+// TestX.<strong hash>.sig : Signature file with strong hashes
+// TestX.hash64.sig : Signature file with 64 bits rabinkarp64 hashes
+// TestX.checksum.sig : Signature file with the BLAKE2b checksum of the input, without modification time
+// TestX.rdiff-<hashes>.sig : librsync signature file, generated by an independent implementation of the librsync format
+// TestX.rdiff-blake2-8.sig : librsync signature file with BLAKE2 strong hashes truncated to 8 bytes
+// the librsync files were not written by rdiff, TestRunRdiff of cmd/rollinghash compares them with rdiff when it is installed
 
 func TestGenerateSignature(t *testing.T) {
 	cases := []struct {
-		name     string
-		testNo   int
-		expError error
+		name       string
+		testNo     int
+		strongHash signature.StrongHashType
+		mmap       bool
+		hash64     bool
+		stdio      bool
+		expError   error
 	}{
 		// Happy Paths
 		{name: "One Chunk file", testNo: 1, expError: nil},
@@ -28,25 +44,73 @@ func TestGenerateSignature(t *testing.T) {
 		{name: "Small Chunk file", testNo: 4, expError: nil},
 		{name: "Big Chunk file", testNo: 5, expError: nil},
 
+		{name: "Two Chunk file with blake2b", testNo: 2, strongHash: signature.STRONG_HASH_BLAKE2B, expError: nil},
+		{name: "Two Chunk file with sha256", testNo: 2, strongHash: signature.STRONG_HASH_SHA256, expError: nil},
+		{name: "Two Chunk file with xxh3", testNo: 2, strongHash: signature.STRONG_HASH_XXH3, expError: nil},
+		{name: "Big Chunk file with blake2b", testNo: 5, strongHash: signature.STRONG_HASH_BLAKE2B, expError: nil},
+		{name: "Big Chunk file with sha256", testNo: 5, strongHash: signature.STRONG_HASH_SHA256, expError: nil},
+		{name: "Big Chunk file with xxh3", testNo: 5, strongHash: signature.STRONG_HASH_XXH3, expError: nil},
+
+		{name: "Two Chunk file with 64 bits hashes", testNo: 2, hash64: true, expError: nil},
+		{name: "Big Chunk file with 64 bits hashes", testNo: 5, hash64: true, expError: nil},
+
+		{name: "One Chunk file with mmap", testNo: 1, mmap: true, expError: nil},
+		{name: "Big Chunk file with mmap", testNo: 5, mmap: true, expError: nil},
+		{name: "Big Chunk file with mmap and sha256", testNo: 5, strongHash: signature.STRONG_HASH_SHA256, mmap: true, expError: nil},
+
+		{name: "Big Chunk file from stdin to stdout", testNo: 5, stdio: true, expError: nil},
+		{name: "Big Chunk file with sha256 from stdin to stdout", testNo: 5, strongHash: signature.STRONG_HASH_SHA256, stdio: true, expError: nil},
+
 		// Unhappy Paths
 		{name: "Empty Input file", testNo: 101, expError: signature.ErrEmptyInputFile},
+		{name: "Unknown strong hash", testNo: 1, strongHash: 9, expError: signature.ErrUnknownStrongHash},
+		{name: "Empty Input file with mmap", testNo: 101, mmap: true, expError: signature.ErrEmptyInputFile},
+		{name: "Empty Input file from stdin", testNo: 101, stdio: true, expError: signature.ErrEmptyInputFile},
 	}
 
 	for _, c := range cases {
 		tf := func(t *testing.T) {
 			inputfile := fmt.Sprintf("testdata/test%d.org", c.testNo)
 			expectedSigfile := fmt.Sprintf("testdata/test%d.sig", c.testNo)
+			if c.strongHash != signature.STRONG_HASH_NONE {
+				expectedSigfile = fmt.Sprintf("testdata/test%d.%s.sig", c.testNo, c.strongHash)
+			}
+			opts := &signature.Options{StrongHash: c.strongHash, Mmap: c.mmap}
+			if c.hash64 {
+				expectedSigfile = fmt.Sprintf("testdata/test%d.hash64.sig", c.testNo)
+				opts.Hash = rollinghash.RABINKARP64
+				opts.Hash64 = true
+			}
 
 			sigfile := fmt.Sprintf("testdata/%s.delta", uuid.New().String())
 			defer os.Remove(sigfile)
 
-			_, err := signature.GenerateSignature(inputfile, sigfile)
+			// the input file is read from stdin and the signature is written to stdout
+			var stdout bytes.Buffer
+			input, output := inputfile, sigfile
+			if c.stdio {
+				stdin, err := os.Open(inputfile)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+				}
+				defer stdin.Close()
+				opts.Stdin, opts.Stdout = stdin, &stdout
+				input, output = "-", "-"
+			}
+
+			_, err := signature.GenerateSignature(input, output, opts)
 			if err != c.expError {
 				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
 			}
 			if err != nil {
 				return
 			}
+			if c.stdio {
+				err = os.WriteFile(sigfile, stdout.Bytes(), 0666)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+				}
+			}
 
 			match, err := util.CompareFileContents(sigfile, expectedSigfile)
 			if err != nil {
@@ -62,27 +126,72 @@ func TestGenerateSignature(t *testing.T) {
 }
 
 func TestReadSignature(t *testing.T) {
+	test2, err := os.ReadFile("testdata/test2.org")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+
 	cases := []struct {
 		name         string
 		testNo       int
+		legacy       bool
+		hash64       bool
+		checksum     bool
+		strongHash   signature.StrongHashType
 		expSignature signature.Signature
 		expError     error
 	}{
 		// Happy Paths
-		{name: "One Chunk file", testNo: 1, expSignature: signature.Signature{ChunkLen: 256, TotalChunks: 1, Hashes: []uint32{3963550426}}, expError: nil},
-		{name: "Two Chunk file", testNo: 2, expSignature: signature.Signature{ChunkLen: 256, TotalChunks: 2, Hashes: []uint32{3963550426, 1999309273}}, expError: nil},
-		{name: "Three Chunk file", testNo: 3, expSignature: signature.Signature{ChunkLen: 256, TotalChunks: 3, Hashes: []uint32{3963550426, 1999309273, 35068120}}, expError: nil},
-		{name: "Small Chunk file", testNo: 4, expSignature: signature.Signature{ChunkLen: 256, TotalChunks: 1, Hashes: []uint32{4150264061}}, expError: nil},
+		{name: "One Chunk file", testNo: 1, expSignature: signature.Signature{Version: signature.SignatureVersion1, ChunkLen: 256, TotalChunks: 1, Hashes: []uint32{3963550426}}, expError: nil},
+		{name: "Two Chunk file", testNo: 2, expSignature: signature.Signature{Version: signature.SignatureVersion1, ChunkLen: 256, TotalChunks: 2, Hashes: []uint32{3963550426, 1999309273}}, expError: nil},
+		{name: "Three Chunk file", testNo: 3, expSignature: signature.Signature{Version: signature.SignatureVersion1, ChunkLen: 256, TotalChunks: 3, Hashes: []uint32{3963550426, 1999309273, 35068120}}, expError: nil},
+		{name: "Small Chunk file", testNo: 4, expSignature: signature.Signature{Version: signature.SignatureVersion1, ChunkLen: 256, TotalChunks: 1, Hashes: []uint32{4150264061}}, expError: nil},
+
+		{name: "Small Chunk file with xxh3", testNo: 4, strongHash: signature.STRONG_HASH_XXH3, expSignature: signature.Signature{Version: signature.SignatureVersion1, Flags: signature.FLAG_STRONG_HASH, StrongHash: signature.STRONG_HASH_XXH3, ChunkLen: 256, TotalChunks: 1, Hashes: []uint32{4150264061}, StrongHashes: [][]byte{{0x9b, 0x68, 0x35, 0x06, 0x6f, 0xa7, 0x67, 0xc0, 0x20, 0x5f, 0x9b, 0xe3, 0x5e, 0x28, 0x0d, 0x26}}}, expError: nil},
+
+		{name: "Two Chunk file with 64 bits hashes", testNo: 2, hash64: true, expSignature: signature.Signature{Version: signature.SignatureVersion1, Flags: signature.FLAG_HASH64, HashType: rollinghash.RABINKARP64, ChunkLen: 256, TotalChunks: 2, Hashes64: []uint64{11706279484023299802, 16459768599646456281}}, expError: nil},
+
+		{name: "Two Chunk file with checksum", testNo: 2, checksum: true, expSignature: signature.Signature{Version: signature.SignatureVersion1, Flags: signature.FLAG_CHECKSUM, ChunkLen: 256, TotalChunks: 2, Hashes: []uint32{3963550426, 1999309273},
+			Checksum: signature.STRONG_HASH_BLAKE2B, Size: 512, Digest: signature.STRONG_HASH_BLAKE2B.Sum(test2)}, expError: nil},
+
+		{name: "Legacy One Chunk file", testNo: 1, legacy: true, expSignature: signature.Signature{ChunkLen: 256, TotalChunks: 1, Hashes: []uint32{3963550426}}, expError: nil},
+		{name: "Legacy Two Chunk file", testNo: 2, legacy: true, expSignature: signature.Signature{ChunkLen: 256, TotalChunks: 2, Hashes: []uint32{3963550426, 1999309273}}, expError: nil},
+		{name: "Legacy Three Chunk file", testNo: 3, legacy: true, expSignature: signature.Signature{ChunkLen: 256, TotalChunks: 3, Hashes: []uint32{3963550426, 1999309273, 35068120}}, expError: nil},
+		{name: "Legacy Small Chunk file", testNo: 4, legacy: true, expSignature: signature.Signature{ChunkLen: 256, TotalChunks: 1, Hashes: []uint32{4150264061}}, expError: nil},
 
 		// Unhappy Paths
 		{name: "Invalid signature file", testNo: 102, expError: signature.ErrInvalidSignatureFile},
 		{name: "Invalid chunk size", testNo: 103, expError: signature.ErrInvalidChunkSize},
+		{name: "Delta file", testNo: 104, expError: signature.ErrInvalidSignatureFile},
+		{name: "Unsupported version", testNo: 105, expError: signature.ErrInvalidSignatureFile},
+		{name: "Unknown flags", testNo: 106, expError: signature.ErrInvalidSignatureFile},
+		{name: "Truncated hash", testNo: 107, expError: signature.ErrInvalidSignatureFile},
+		{name: "Unknown strong hash", testNo: 108, expError: signature.ErrInvalidSignatureFile},
+		{name: "Truncated checksum", testNo: 109, expError: signature.ErrInvalidSignatureFile},
+		{name: "Unknown checksum", testNo: 110, expError: signature.ErrInvalidSignatureFile},
+		{name: "librsync empty strong hash", testNo: 111, expError: signature.ErrInvalidSignatureFile},
+		{name: "librsync strong hash longer than BLAKE2", testNo: 112, expError: signature.ErrInvalidSignatureFile},
+		{name: "librsync truncated strong hash", testNo: 113, expError: signature.ErrInvalidSignatureFile},
+		{name: "librsync invalid chunk size", testNo: 114, expError: signature.ErrInvalidChunkSize},
+		{name: "librsync delta file", testNo: 115, expError: signature.ErrInvalidSignatureFile},
 	}
 
 	for _, c := range cases {
 		tf := func(t *testing.T) {
 			sigfile := fmt.Sprintf("testdata/test%d.sig", c.testNo)
-			signature, err := signature.ReadSignature(sigfile)
+			if c.legacy {
+				sigfile = fmt.Sprintf("testdata/test%d.v0.sig", c.testNo)
+			}
+			if c.strongHash != signature.STRONG_HASH_NONE {
+				sigfile = fmt.Sprintf("testdata/test%d.%s.sig", c.testNo, c.strongHash)
+			}
+			if c.hash64 {
+				sigfile = fmt.Sprintf("testdata/test%d.hash64.sig", c.testNo)
+			}
+			if c.checksum {
+				sigfile = fmt.Sprintf("testdata/test%d.checksum.sig", c.testNo)
+			}
+			signature, err := signature.ReadSignature(sigfile, nil)
 			if err != c.expError {
 				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
 			}
@@ -98,3 +207,234 @@ func TestReadSignature(t *testing.T) {
 		t.Run(c.name, tf)
 	}
 }
+
+func TestWrite(t *testing.T) {
+	cases := []struct {
+		name        string
+		testNo      int
+		unsized     bool
+		opts        *signature.Options
+		expChunkLen uint32
+		expError    error
+	}{
+		// Happy Paths
+		{name: "One Chunk file", testNo: 1, expChunkLen: 256, expError: nil},
+		{name: "Big Chunk file", testNo: 5, expChunkLen: 384, expError: nil},
+		{name: "Big Chunk file with unknown size", testNo: 5, unsized: true, expChunkLen: signature.DefaultChunkLen, expError: nil},
+
+		{name: "Min chunk length", testNo: 5, opts: &signature.Options{ChunkLen: signature.MinChunkLen}, expChunkLen: signature.MinChunkLen, expError: nil},
+		{name: "Chunk length not a multiple of 128", testNo: 5, opts: &signature.Options{ChunkLen: 1000}, expChunkLen: 1000, expError: nil},
+		{name: "Chunk length with unknown size", testNo: 5, unsized: true, opts: &signature.Options{ChunkLen: 100}, expChunkLen: 100, expError: nil},
+		{name: "Max chunk length", testNo: 5, opts: &signature.Options{ChunkLen: signature.MaxChunkLen}, expChunkLen: signature.MaxChunkLen, expError: nil},
+		{name: "Big Chunk file with rsync heuristic", testNo: 5, opts: &signature.Options{ChunkSizeHeuristic: signature.CHUNK_SIZE_RSYNC}, expChunkLen: 700, expError: nil},
+		{name: "Big Chunk file with tiered heuristic", testNo: 5, opts: &signature.Options{ChunkSizeHeuristic: signature.CHUNK_SIZE_TIERED}, expChunkLen: 512, expError: nil},
+		{name: "Heuristic with unknown size", testNo: 5, unsized: true, opts: &signature.Options{ChunkSizeHeuristic: signature.CHUNK_SIZE_TIERED}, expChunkLen: signature.DefaultChunkLen, expError: nil},
+
+		{name: "Checksum", testNo: 5, opts: &signature.Options{Checksum: signature.STRONG_HASH_SHA256}, expChunkLen: 384, expError: nil},
+		{name: "Checksum with unknown size", testNo: 5, unsized: true, opts: &signature.Options{Checksum: signature.STRONG_HASH_XXH3}, expChunkLen: signature.DefaultChunkLen, expError: nil},
+		{name: "Checksum with jobs", testNo: 5, opts: &signature.Options{Checksum: signature.STRONG_HASH_BLAKE2B, Jobs: 4}, expChunkLen: 384, expError: nil},
+		{name: "Checksum with content defined chunks", testNo: 5, opts: &signature.Options{Checksum: signature.STRONG_HASH_BLAKE2B, CDC: &signature.CDCOptions{MinChunkLen: 64, AvgChunkLen: 256, MaxChunkLen: 1024}}, expChunkLen: 256, expError: nil},
+
+		// Unhappy Paths
+		{name: "Empty Input file", testNo: 101, expError: signature.ErrEmptyInputFile},
+		{name: "Empty Input file with unknown size", testNo: 101, unsized: true, expError: signature.ErrEmptyInputFile},
+		{name: "Chunk length below min", testNo: 5, opts: &signature.Options{ChunkLen: signature.MinChunkLen - 1}, expError: signature.ErrInvalidChunkSize},
+		{name: "Chunk length above max", testNo: 5, opts: &signature.Options{ChunkLen: signature.MaxChunkLen + 1}, expError: signature.ErrInvalidChunkSize},
+		{name: "Unknown heuristic", testNo: 5, opts: &signature.Options{ChunkSizeHeuristic: 9}, expError: signature.ErrUnknownChunkSizeHeuristic},
+		{name: "Unknown checksum", testNo: 5, opts: &signature.Options{Checksum: 9}, expError: signature.ErrUnknownStrongHash},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			data, err := os.ReadFile(fmt.Sprintf("testdata/test%d.org", c.testNo))
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+
+			// io.MultiReader hides the size of the bytes.Reader
+			var r io.Reader = bytes.NewReader(data)
+			if c.unsized {
+				r = io.MultiReader(r)
+			}
+
+			var buf bytes.Buffer
+			sig, err := signature.Write(&buf, r, c.opts)
+			if !errors.Is(err, c.expError) {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				return
+			}
+			if sig.ChunkLen != c.expChunkLen {
+				t.Fatalf("'%s' Failed : expected chunk length:%d, got:%d", t.Name(), c.expChunkLen, sig.ChunkLen)
+			}
+			if sig.Flags&signature.FLAG_CHECKSUM != 0 && (sig.Size != uint64(len(data)) || !bytes.Equal(sig.Digest, sig.Checksum.Sum(data)) || !sig.ModTime.IsZero()) {
+				t.Fatalf("'%s' Failed : unexpected checksum %x of %d bytes", t.Name(), sig.Digest, sig.Size)
+			}
+
+			readSig, err := signature.Read(&buf, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+			if !reflect.DeepEqual(sig, readSig) {
+				t.Fatalf("'%s' Failed : signature does not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+// sizedReader reports the size of an input without reading it
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+func (r sizedReader) Size() int64 {
+	return r.size
+}
+
+func TestWriteTooManyChunks(t *testing.T) {
+	const tooLarge = signature.MaxChunks*signature.MinChunkLen + 1
+
+	cases := []struct {
+		name     string
+		opts     *signature.Options
+		expError error
+	}{
+		// Unhappy Paths
+		{name: "Fixed size chunks", opts: &signature.Options{ChunkLen: signature.MinChunkLen}, expError: signature.ErrInvalidChunkSize},
+		{name: "Content defined chunks", opts: &signature.Options{CDC: &signature.CDCOptions{MinChunkLen: signature.MinChunkLen, AvgChunkLen: 256, MaxChunkLen: 1024}}, expError: signature.ErrInvalidChunkSize},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			// the size is rejected before the input is read
+			r := sizedReader{Reader: bytes.NewReader(nil), size: tooLarge}
+			_, err := signature.Write(io.Discard, r, c.opts)
+			if !errors.Is(err, c.expError) {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestChunkSizeHeuristic(t *testing.T) {
+	cases := []struct {
+		name        string
+		heuristic   signature.ChunkSizeHeuristic
+		size        int64
+		expChunkLen uint32
+	}{
+		{name: "sqrt small file", heuristic: signature.CHUNK_SIZE_SQRT, size: 1000, expChunkLen: 256},
+		{name: "sqrt 1 GB", heuristic: signature.CHUNK_SIZE_SQRT, size: 1 << 30, expChunkLen: 32768},
+		{name: "rsync small file", heuristic: signature.CHUNK_SIZE_RSYNC, size: 1000, expChunkLen: 700},
+		{name: "rsync 1 MB", heuristic: signature.CHUNK_SIZE_RSYNC, size: 1000 * 1000, expChunkLen: 1000},
+		{name: "rsync 1 GB", heuristic: signature.CHUNK_SIZE_RSYNC, size: 1 << 30, expChunkLen: 32768},
+		{name: "rsync 1 TB", heuristic: signature.CHUNK_SIZE_RSYNC, size: 1 << 40, expChunkLen: 128 * 1024},
+		{name: "tiered 1 MB", heuristic: signature.CHUNK_SIZE_TIERED, size: 1 << 20, expChunkLen: 512},
+		{name: "tiered 1 GB", heuristic: signature.CHUNK_SIZE_TIERED, size: 1 << 30, expChunkLen: 8 * 1024},
+		{name: "tiered 1 TB", heuristic: signature.CHUNK_SIZE_TIERED, size: 1 << 40, expChunkLen: 128 * 1024},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			chunkLen, err := c.heuristic.ChunkLen(c.size)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+			if chunkLen != c.expChunkLen {
+				t.Fatalf("'%s' Failed : expected chunk length:%d, got:%d", t.Name(), c.expChunkLen, chunkLen)
+			}
+
+			parsed, err := signature.ParseChunkSizeHeuristic(c.heuristic.String())
+			if err != nil || parsed != c.heuristic {
+				t.Fatalf("'%s' Failed : expected %s, got %s with error %v", t.Name(), c.heuristic, parsed, err)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestStrongHashNew(t *testing.T) {
+	data, err := os.ReadFile("testdata/test2.org")
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+
+	for _, hashType := range []signature.StrongHashType{signature.STRONG_HASH_BLAKE2B, signature.STRONG_HASH_SHA256, signature.STRONG_HASH_XXH3} {
+		tf := func(t *testing.T) {
+			h := hashType.New()
+			if h.Size() != hashType.Size() {
+				t.Fatalf("'%s' Failed : expected size:%d, got:%d", t.Name(), hashType.Size(), h.Size())
+			}
+			// the data written in parts has the strong hash of the whole data
+			h.Write(data[:100])
+			h.Write(data[100:])
+			if !bytes.Equal(h.Sum(nil), hashType.Sum(data)) {
+				t.Fatalf("'%s' Failed : expected sum:%x, got:%x", t.Name(), hashType.Sum(data), h.Sum(nil))
+			}
+		}
+
+		t.Run(hashType.String(), tf)
+	}
+}
+
+func TestGenerateSignatureChecksum(t *testing.T) {
+	const inputfile = "testdata/test5.org"
+	data, err := os.ReadFile(inputfile)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+	stats, err := os.Stat(inputfile)
+	if err != nil {
+		t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+	}
+
+	cases := []struct {
+		name       string
+		mmap       bool
+		stdin      bool
+		expModTime time.Time
+	}{
+		{name: "Input file", expModTime: stats.ModTime()},
+		{name: "Input file with mmap", mmap: true, expModTime: stats.ModTime()},
+		{name: "Input file from stdin", stdin: true, expModTime: time.Time{}},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			sigfile := fmt.Sprintf("testdata/%s.sig", uuid.New().String())
+			defer os.Remove(sigfile)
+
+			// stdin is not a file, its modification time is not known
+			opts := &signature.Options{Checksum: signature.STRONG_HASH_BLAKE2B, Mmap: c.mmap}
+			input := inputfile
+			if c.stdin {
+				opts.Stdin = bytes.NewReader(data)
+				input = "-"
+			}
+			_, err := signature.GenerateSignature(input, sigfile, opts)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+
+			sig, err := signature.ReadSignature(sigfile, nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+			if sig.Size != uint64(len(data)) || !bytes.Equal(sig.Digest, signature.STRONG_HASH_BLAKE2B.Sum(data)) {
+				t.Fatalf("'%s' Failed : unexpected checksum %x of %d bytes", t.Name(), sig.Digest, sig.Size)
+			}
+			if !sig.ModTime.Equal(c.expModTime) {
+				t.Fatalf("'%s' Failed : expected modification time:%v, got:%v", t.Name(), c.expModTime, sig.ModTime)
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
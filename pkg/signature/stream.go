@@ -0,0 +1,462 @@
+package signature
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/SDkie/rollinghash/pkg/format"
+	"github.com/SDkie/rollinghash/pkg/rollinghash"
+	"github.com/SDkie/rollinghash/pkg/util"
+)
+
+// Chunk is the entry of a chunk in a signature file
+type Chunk struct {
+	Index uint32
+	Hash  uint32
+	// Hash64 is only set with FLAG_HASH64, instead of Hash
+	Hash64 uint64
+	// Len is only set with FLAG_VARIABLE_CHUNKS
+	Len uint32
+	// StrongHash is only set with FLAG_STRONG_HASH
+	StrongHash []byte
+}
+
+// Writer writes a signature file one chunk at a time,
+// so the hashes don't need to be kept in memory
+type Writer struct {
+	w           *bufio.Writer
+	header      Signature
+	totalChunks uint32
+	// checksum is set once the checksum was written with FLAG_CHECKSUM
+	checksum bool
+	log      *slog.Logger
+	debug    bool
+}
+
+// NewWriter returns a Writer writing a signature with the header fields of header to w
+// The chunks of header are ignored, they are written with WriteChunk.
+// Only the Logger of opts is used.
+func NewWriter(w io.Writer, header *Signature, opts *Options) *Writer {
+	sw := &Writer{
+		w:      bufio.NewWriter(w),
+		header: *header,
+		log:    opts.logger(),
+	}
+	if sw.header.Format == format.NATIVE {
+		sw.header.Version = SignatureVersionLatest
+	}
+	sw.header.TotalChunks = 0
+	sw.header.Hashes = nil
+	sw.header.Hashes64 = nil
+	sw.header.StrongHashes = nil
+	sw.header.ChunkLens = nil
+	sw.header.Size = 0
+	sw.header.ModTime = time.Time{}
+	sw.header.Digest = nil
+	sw.debug = sw.log.Enabled(context.Background(), slog.LevelDebug)
+	return sw
+}
+
+// WriteChunk writes the next chunk to the signature file, the index of the chunk is ignored
+// The header is written with the first chunk, so nothing is written for an empty input.
+// ErrInvalidChunkSize is returned after MaxChunks chunks, the chunks are too short for the input.
+func (sw *Writer) WriteChunk(c Chunk) error {
+	if sw.totalChunks == MaxChunks {
+		err := ErrInvalidChunkSize
+		sw.log.Error(err.Error(), "totalChunks", sw.totalChunks, "chunkLen", sw.header.ChunkLen)
+		return err
+	}
+	if sw.header.Flags&FLAG_STRONG_HASH != 0 && len(c.StrongHash) != sw.header.strongLen() {
+		err := fmt.Errorf("strong hash of chunk %d has %d bytes, expected %d", sw.totalChunks, len(c.StrongHash), sw.header.strongLen())
+		sw.log.Error(err.Error())
+		return err
+	}
+
+	if sw.totalChunks == 0 {
+		err := sw.writeHeader()
+		if err != nil {
+			sw.log.Error("error writing to signature file", "err", err)
+			return err
+		}
+	}
+
+	var data []byte
+	if sw.header.Flags&FLAG_HASH64 != 0 {
+		data = binary.BigEndian.AppendUint64(data, c.Hash64)
+	} else {
+		data = binary.BigEndian.AppendUint32(data, c.Hash)
+	}
+	if sw.header.Flags&FLAG_VARIABLE_CHUNKS != 0 {
+		data = binary.BigEndian.AppendUint32(data, c.Len)
+	}
+	data = append(data, c.StrongHash...)
+	_, err := sw.w.Write(data)
+	if err != nil {
+		sw.log.Error("error writing to signature file", "err", err)
+		return err
+	}
+
+	if sw.debug {
+		sw.log.Debug("chunk", "index", sw.totalChunks, "hash", fmt.Sprintf("%08x", uint64(c.Hash)|c.Hash64), "len", c.Len)
+	}
+	sw.totalChunks++
+	return nil
+}
+
+// WriteChecksum writes the size, modification time and strong hash of the whole input file after the last chunk
+// It is only written with FLAG_CHECKSUM, the zero modTime records an unknown modification time.
+func (sw *Writer) WriteChecksum(size uint64, modTime time.Time, digest []byte) error {
+	if sw.header.Flags&FLAG_CHECKSUM == 0 || sw.checksum {
+		err := fmt.Errorf("unexpected checksum of the input file")
+		sw.log.Error(err.Error())
+		return err
+	}
+	if len(digest) != sw.header.Checksum.Size() {
+		err := fmt.Errorf("checksum of the input file has %d bytes, expected %d", len(digest), sw.header.Checksum.Size())
+		sw.log.Error(err.Error())
+		return err
+	}
+	if sw.totalChunks == 0 {
+		err := ErrEmptyInputFile
+		sw.log.Error(err.Error())
+		return err
+	}
+
+	data := binary.BigEndian.AppendUint64(nil, size)
+	data = binary.BigEndian.AppendUint64(data, uint64(unixNano(modTime)))
+	data = append(data, digest...)
+	_, err := sw.w.Write(data)
+	if err != nil {
+		sw.log.Error("error writing to signature file", "err", err)
+		return err
+	}
+	sw.checksum = true
+	return nil
+}
+
+// Flush writes the buffered data to the underlying writer
+// It returns ErrEmptyInputFile if no chunk was written.
+// With FLAG_CHECKSUM, the checksum must be written before.
+func (sw *Writer) Flush() error {
+	if sw.totalChunks == 0 {
+		err := ErrEmptyInputFile
+		sw.log.Error(err.Error())
+		return err
+	}
+	if sw.header.Flags&FLAG_CHECKSUM != 0 && !sw.checksum {
+		err := fmt.Errorf("missing checksum of the input file")
+		sw.log.Error(err.Error())
+		return err
+	}
+
+	err := sw.w.Flush()
+	if err != nil {
+		sw.log.Error("error writing to signature file", "err", err)
+		return err
+	}
+	sw.log.Info("signature", "totalChunks", sw.totalChunks)
+	return nil
+}
+
+// TotalChunks returns the number of chunks written
+func (sw *Writer) TotalChunks() uint32 {
+	return sw.totalChunks
+}
+
+// writeHeader writes the header fields to the signature file
+func (sw *Writer) writeHeader() error {
+	s := &sw.header
+	if s.Format == format.LIBRSYNC {
+		return sw.writeLibrsyncHeader()
+	}
+	header := format.Header{Magic: format.SignatureMagic, Version: s.Version, Flags: s.Flags}
+	err := header.Write(sw.w)
+	if err != nil {
+		return err
+	}
+
+	_, err = sw.w.Write([]byte{byte(s.HashType)})
+	if err != nil {
+		return err
+	}
+
+	err = util.WriteUint32InHex(sw.w, s.ChunkLen)
+	if err != nil {
+		return err
+	}
+
+	if s.Flags&FLAG_VARIABLE_CHUNKS != 0 {
+		err = util.WriteUint32InHex(sw.w, s.MinChunkLen)
+		if err != nil {
+			return err
+		}
+		err = util.WriteUint32InHex(sw.w, s.MaxChunkLen)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Flags&FLAG_STRONG_HASH != 0 {
+		_, err = sw.w.Write([]byte{byte(s.StrongHash)})
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Flags&FLAG_CHECKSUM != 0 {
+		_, err = sw.w.Write([]byte{byte(s.Checksum)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader reads a signature file one chunk at a time,
+// so the hashes don't need to be kept in memory
+type Reader struct {
+	r      *bufio.Reader
+	header Signature
+	index  uint32
+	// done is set once the last chunk was read
+	done  bool
+	buf   [8]byte
+	log   *slog.Logger
+	debug bool
+}
+
+// NewReader reads the header of the signature file from r and returns a Reader for its chunks
+// Legacy signature files without header are also supported.
+// Only the Logger of opts is used.
+func NewReader(r io.Reader, opts *Options) (*Reader, error) {
+	sr := &Reader{
+		r:   bufio.NewReader(r),
+		log: opts.logger(),
+	}
+	sr.debug = sr.log.Enabled(context.Background(), slog.LevelDebug)
+
+	err := sr.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// Header returns the header fields of the signature, without the chunks
+// The checksum fields after the chunks are only set once Next returned io.EOF.
+func (sr *Reader) Header() *Signature {
+	header := sr.header
+	return &header
+}
+
+// Next returns the next chunk of the signature file
+// It returns io.EOF when there are no more chunks.
+// A signature file without chunks is invalid.
+func (sr *Reader) Next() (Chunk, error) {
+	if sr.done {
+		return Chunk{}, io.EOF
+	}
+
+	// EOF is only valid at the start of a chunk, after the checksum with FLAG_CHECKSUM
+	end, err := sr.readChecksum()
+	if err != nil {
+		return Chunk{}, err
+	}
+	if end {
+		if sr.index == 0 {
+			err := ErrInvalidSignatureFile
+			sr.log.Error(err.Error(), "totalChunks", 0)
+			return Chunk{}, err
+		}
+		sr.log.Info("signature", "totalChunks", sr.index)
+		sr.done = true
+		return Chunk{}, io.EOF
+	}
+
+	c := Chunk{Index: sr.index}
+	if sr.header.Flags&FLAG_HASH64 != 0 {
+		c.Hash64, err = sr.readUint64()
+	} else {
+		c.Hash, err = sr.readUint32()
+	}
+	if err != nil {
+		return Chunk{}, err
+	}
+
+	if sr.header.Flags&FLAG_VARIABLE_CHUNKS != 0 {
+		c.Len, err = sr.readUint32()
+		if err != nil {
+			return Chunk{}, err
+		}
+		if c.Len == 0 || c.Len > sr.header.MaxChunkLen {
+			err := ErrInvalidSignatureFile
+			sr.log.Error(err.Error(), "chunk", sr.index, "len", c.Len)
+			return Chunk{}, err
+		}
+	}
+
+	if sr.header.StrongHash != STRONG_HASH_NONE {
+		c.StrongHash = make([]byte, sr.header.strongLen())
+		_, err = io.ReadFull(sr.r, c.StrongHash)
+		if err != nil {
+			sr.log.Error("error reading signature file", "err", err)
+			return Chunk{}, ErrInvalidSignatureFile
+		}
+	}
+
+	if sr.debug {
+		sr.log.Debug("chunk", "index", c.Index, "hash", fmt.Sprintf("%08x", uint64(c.Hash)|c.Hash64))
+	}
+	sr.index++
+	return c, nil
+}
+
+// readHeader reads the header fields of the signature file
+func (sr *Reader) readHeader() error {
+	s := &sr.header
+	if magic, ok := format.PeekLibrsyncMagic(sr.r); ok && magic != format.RS_DELTA_MAGIC {
+		return sr.readLibrsyncHeader()
+	}
+	header, err := format.ReadHeader(sr.r, format.SignatureMagic)
+	if err != nil {
+		sr.log.Error(ErrInvalidSignatureFile.Error(), "err", err)
+		return ErrInvalidSignatureFile
+	}
+	s.Version = header.Version
+	s.Flags = header.Flags
+	if s.Version > SignatureVersionLatest || s.Flags&^knownFlags != 0 {
+		err := ErrInvalidSignatureFile
+		sr.log.Error(err.Error(), "version", header.Version, "flags", header.Flags)
+		return err
+	}
+
+	if s.Version != SignatureVersionLegacy {
+		hashType, err := sr.readByte()
+		if err != nil {
+			return err
+		}
+		s.HashType = rollinghash.Type(hashType)
+		if _, err := rollinghash.New(s.HashType); err != nil {
+			err := ErrInvalidSignatureFile
+			sr.log.Error(err.Error(), "hashType", uint8(s.HashType))
+			return err
+		}
+	}
+
+	s.ChunkLen, err = sr.readUint32()
+	if err != nil {
+		return err
+	}
+	if !validChunkLen(s.ChunkLen) {
+		err := ErrInvalidChunkSize
+		sr.log.Error(err.Error())
+		return err
+	}
+
+	if s.Flags&FLAG_VARIABLE_CHUNKS != 0 {
+		s.MinChunkLen, err = sr.readUint32()
+		if err != nil {
+			return err
+		}
+		s.MaxChunkLen, err = sr.readUint32()
+		if err != nil {
+			return err
+		}
+		if !validCDCChunkLens(s.MinChunkLen, s.ChunkLen, s.MaxChunkLen) {
+			err := ErrInvalidChunkSize
+			sr.log.Error(err.Error())
+			return err
+		}
+	}
+
+	if s.Flags&FLAG_STRONG_HASH != 0 {
+		strongHash, err := sr.readByte()
+		if err != nil {
+			return err
+		}
+		s.StrongHash = StrongHashType(strongHash)
+		if s.StrongHash.Size() == 0 {
+			err := ErrInvalidSignatureFile
+			sr.log.Error(err.Error(), "strongHash", uint8(s.StrongHash))
+			return err
+		}
+	}
+
+	if s.Flags&FLAG_CHECKSUM != 0 {
+		checksum, err := sr.readByte()
+		if err != nil {
+			return err
+		}
+		s.Checksum = StrongHashType(checksum)
+		if s.Checksum.Size() == 0 {
+			err := ErrInvalidSignatureFile
+			sr.log.Error(err.Error(), "checksum", uint8(s.Checksum))
+			return err
+		}
+	}
+
+	sr.log.Info("signature", "version", s.Version, "hash", s.HashType, "chunkLen", s.ChunkLen)
+	return nil
+}
+
+// readChecksum reports whether the chunks are over
+// The checksum of the input file is read then with FLAG_CHECKSUM, the chunks are over when only the checksum is left.
+func (sr *Reader) readChecksum() (bool, error) {
+	s := &sr.header
+	n := 0
+	if s.Flags&FLAG_CHECKSUM != 0 {
+		n = checksumLen + s.Checksum.Size()
+	}
+	data, err := sr.r.Peek(n + 1)
+	if len(data) > n {
+		return false, nil
+	}
+	if err != io.EOF || len(data) < n {
+		sr.log.Error("error reading signature file", "err", err)
+		return false, ErrInvalidSignatureFile
+	}
+	if n == 0 {
+		return true, nil
+	}
+
+	s.Size = binary.BigEndian.Uint64(data)
+	s.ModTime = fromUnixNano(int64(binary.BigEndian.Uint64(data[8:])))
+	s.Digest = append([]byte(nil), data[checksumLen:]...)
+	sr.r.Discard(n)
+	return true, nil
+}
+
+// readByte reads a byte from the signature file
+func (sr *Reader) readByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err != nil {
+		sr.log.Error("error reading signature file", "err", err)
+		return 0, ErrInvalidSignatureFile
+	}
+	return b, nil
+}
+
+// readUint32 reads a big endian uint32 from the signature file
+func (sr *Reader) readUint32() (uint32, error) {
+	_, err := io.ReadFull(sr.r, sr.buf[:4])
+	if err != nil {
+		sr.log.Error("error reading signature file", "err", err)
+		return 0, ErrInvalidSignatureFile
+	}
+	return binary.BigEndian.Uint32(sr.buf[:4]), nil
+}
+
+// readUint64 reads a big endian uint64 from the signature file
+func (sr *Reader) readUint64() (uint64, error) {
+	_, err := io.ReadFull(sr.r, sr.buf[:])
+	if err != nil {
+		sr.log.Error("error reading signature file", "err", err)
+		return 0, ErrInvalidSignatureFile
+	}
+	return binary.BigEndian.Uint64(sr.buf[:]), nil
+}
@@ -0,0 +1,152 @@
+package signature_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/signature"
+)
+
+func TestReader(t *testing.T) {
+	cases := []struct {
+		name     string
+		sigfile  string
+		expError error
+	}{
+		// Happy Paths
+		{name: "Big Chunk file", sigfile: "test5.sig", expError: nil},
+		{name: "Big Chunk file with blake2b", sigfile: "test5.blake2b.sig", expError: nil},
+		{name: "Legacy Big Chunk file", sigfile: "test5.v0.sig", expError: nil},
+
+		// Unhappy Paths
+		{name: "Invalid chunk size", sigfile: "test103.sig", expError: signature.ErrInvalidChunkSize},
+		{name: "Delta file", sigfile: "test104.sig", expError: signature.ErrInvalidSignatureFile},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + c.sigfile)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+
+			sr, err := signature.NewReader(bytes.NewReader(data), nil)
+			if err != c.expError {
+				t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), c.expError, err)
+			}
+			if err != nil {
+				return
+			}
+
+			sig, err := signature.Read(bytes.NewReader(data), nil)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+			if !reflect.DeepEqual(sr.Header().ChunkLen, sig.ChunkLen) || sr.Header().Hashes != nil {
+				t.Fatalf("'%s' Failed : header does not match", t.Name())
+			}
+
+			for i := uint32(0); ; i++ {
+				chunk, err := sr.Next()
+				if err == io.EOF {
+					if i != sig.TotalChunks {
+						t.Fatalf("'%s' Failed : expected %d chunks, got %d", t.Name(), sig.TotalChunks, i)
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+				}
+				if chunk.Index != i || chunk.Hash != sig.Hashes[i] {
+					t.Fatalf("'%s' Failed : expected chunk %d:%08x, got %d:%08x", t.Name(), i, sig.Hashes[i], chunk.Index, chunk.Hash)
+				}
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	cases := []struct {
+		name string
+		opts signature.Options
+	}{
+		{name: "strong hash none", opts: signature.Options{}},
+		{name: "strong hash sha256", opts: signature.Options{StrongHash: signature.STRONG_HASH_SHA256}},
+		{name: "checksum xxh3", opts: signature.Options{Checksum: signature.STRONG_HASH_XXH3}},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			data, err := os.ReadFile("testdata/test5.org")
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+
+			var expected bytes.Buffer
+			sig, err := signature.Write(&expected, bytes.NewReader(data), &c.opts)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+
+			// chunks are written one at a time with the header of sig
+			var buf bytes.Buffer
+			sw := signature.NewWriter(&buf, sig, nil)
+			for i, hash := range sig.Hashes {
+				chunk := signature.Chunk{Hash: hash}
+				if sig.StrongHashes != nil {
+					chunk.StrongHash = sig.StrongHashes[i]
+				}
+				err = sw.WriteChunk(chunk)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+				}
+			}
+			if sig.Flags&signature.FLAG_CHECKSUM != 0 {
+				err = sw.WriteChecksum(sig.Size, sig.ModTime, sig.Digest)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+				}
+			}
+			err = sw.Flush()
+			if err != nil {
+				t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+				t.Fatalf("'%s' Failed : signature contents do not match", t.Name())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+
+	t.Run("No chunks", func(t *testing.T) {
+		var buf bytes.Buffer
+		sw := signature.NewWriter(&buf, &signature.Signature{ChunkLen: 256}, nil)
+		err := sw.Flush()
+		if err != signature.ErrEmptyInputFile {
+			t.Fatalf("'%s' Failed : expected error:%v, got:%v", t.Name(), signature.ErrEmptyInputFile, err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("'%s' Failed : expected no output, got %d bytes", t.Name(), buf.Len())
+		}
+	})
+
+	t.Run("Missing checksum", func(t *testing.T) {
+		var buf bytes.Buffer
+		sw := signature.NewWriter(&buf, &signature.Signature{Flags: signature.FLAG_CHECKSUM, Checksum: signature.STRONG_HASH_XXH3, ChunkLen: 256}, nil)
+		err := sw.WriteChunk(signature.Chunk{Hash: 1})
+		if err != nil {
+			t.Fatalf("'%s' Failed with error : %v", t.Name(), err)
+		}
+		err = sw.Flush()
+		if err == nil {
+			t.Fatalf("'%s' Failed : expected error for the missing checksum", t.Name())
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package signature
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/zeebo/xxh3"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/md4"
+)
+
+var ErrUnknownStrongHash = errors.New("unknown strong hash")
+
+// StrongHashType is the hash algorithm used for verifying the content of matched chunks
+type StrongHashType uint8
+
+const (
+	STRONG_HASH_NONE StrongHashType = iota
+	STRONG_HASH_BLAKE2B
+	STRONG_HASH_SHA256
+	STRONG_HASH_XXH3
+	// STRONG_HASH_MD4 is only meant for the signatures of librsync, MD4 is broken
+	STRONG_HASH_MD4
+)
+
+var strongHashNames = map[StrongHashType]string{
+	STRONG_HASH_NONE:    "none",
+	STRONG_HASH_BLAKE2B: "blake2b",
+	STRONG_HASH_SHA256:  "sha256",
+	STRONG_HASH_XXH3:    "xxh3",
+	STRONG_HASH_MD4:     "md4",
+}
+
+// ParseStrongHashType returns the StrongHashType for the given name
+func ParseStrongHashType(name string) (StrongHashType, error) {
+	for t, n := range strongHashNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return STRONG_HASH_NONE, fmt.Errorf("%w: %s", ErrUnknownStrongHash, name)
+}
+
+func (t StrongHashType) String() string {
+	name, ok := strongHashNames[t]
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+	return name
+}
+
+// Size returns the size of the strong hash in bytes
+func (t StrongHashType) Size() int {
+	switch t {
+	case STRONG_HASH_BLAKE2B:
+		return blake2b.Size256
+	case STRONG_HASH_SHA256:
+		return sha256.Size
+	case STRONG_HASH_XXH3:
+		return 16
+	case STRONG_HASH_MD4:
+		return md4.Size
+	default:
+		return 0
+	}
+}
+
+// Sum returns the strong hash of the chunk
+func (t StrongHashType) Sum(chunk []byte) []byte {
+	switch t {
+	case STRONG_HASH_BLAKE2B:
+		sum := blake2b.Sum256(chunk)
+		return sum[:]
+	case STRONG_HASH_SHA256:
+		sum := sha256.Sum256(chunk)
+		return sum[:]
+	case STRONG_HASH_XXH3:
+		sum := xxh3.Hash128(chunk).Bytes()
+		return sum[:]
+	case STRONG_HASH_MD4:
+		h := md4.New()
+		h.Write(chunk)
+		return h.Sum(nil)
+	default:
+		return nil
+	}
+}
+
+// New returns a hash.Hash computing the strong hash of data written in several parts,
+// its Sum is the same as the Sum of the whole data. It returns nil for STRONG_HASH_NONE.
+func (t StrongHashType) New() hash.Hash {
+	switch t {
+	case STRONG_HASH_BLAKE2B:
+		h, _ := blake2b.New256(nil)
+		return h
+	case STRONG_HASH_SHA256:
+		return sha256.New()
+	case STRONG_HASH_XXH3:
+		return xxh3Hash128{xxh3.New()}
+	case STRONG_HASH_MD4:
+		return md4.New()
+	default:
+		return nil
+	}
+}
+
+// xxh3Hash128 is the 128 bits xxh3 hash.Hash, xxh3.Hasher sums 64 bits
+type xxh3Hash128 struct {
+	*xxh3.Hasher
+}
+
+func (h xxh3Hash128) Size() int { return 16 }
+
+func (h xxh3Hash128) Sum(b []byte) []byte {
+	sum := h.Sum128().Bytes()
+	return append(b, sum[:]...)
+}
@@ -0,0 +1,119 @@
+package util
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// AtomicFile is an output file written to a temporary file in the same directory,
+// which replaces the file by Commit, so a failed write never leaves a partial file behind
+type AtomicFile struct {
+	*os.File
+	name      string
+	overwrite bool
+	committed bool
+}
+
+// CreateAtomic creates the temporary file of the output file name
+// It returns fs.ErrExist when the file exists and overwrite is not set.
+// A new file is created with mode 0666 less the umask, a replaced file keeps its mode.
+func CreateAtomic(name string, overwrite bool) (*AtomicFile, error) {
+	var mode fs.FileMode
+	stats, err := os.Stat(name)
+	if err == nil {
+		if !overwrite {
+			return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+		}
+		mode = stats.Mode().Perm()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	f, err := createTemp(name)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		err = f.Chmod(mode)
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, err
+		}
+	}
+	return &AtomicFile{File: f, name: name, overwrite: overwrite}, nil
+}
+
+// createTemp creates a new temporary file next to name with mode 0666, so the umask applies,
+// unlike os.CreateTemp which creates it with mode 0600
+func createTemp(name string) (*os.File, error) {
+	dir, base := filepath.Split(name)
+	for i := 0; ; i++ {
+		tmpName := filepath.Join(dir, "."+base+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		f, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, fs.ErrExist) && i < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// Commit syncs the temporary file to the disk and renames it to the output file name
+// Without overwrite, it returns fs.ErrExist when the file was created since CreateAtomic.
+func (f *AtomicFile) Commit() error {
+	err := f.File.Sync()
+	if err == nil {
+		err = f.File.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	if f.overwrite {
+		err = os.Rename(f.File.Name(), f.name)
+	} else {
+		err = renameNoReplace(f.File.Name(), f.name)
+	}
+	if err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	f.committed = true
+
+	// the rename is only durable once the directory is synced, it is not supported everywhere
+	if dir, err := os.Open(filepath.Dir(f.name)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// renameNoReplace renames oldname to newname unless newname exists
+// a hard link fails when newname exists, unlike a rename,
+// file systems without hard links fall back to a rename
+func renameNoReplace(oldname, newname string) error {
+	err := os.Link(oldname, newname)
+	if err == nil {
+		return os.Remove(oldname)
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	if _, statErr := os.Lstat(newname); !errors.Is(statErr, fs.ErrNotExist) {
+		return err
+	}
+	return os.Rename(oldname, newname)
+}
+
+// Close removes the temporary file when it was not committed
+func (f *AtomicFile) Close() error {
+	if f.committed {
+		return nil
+	}
+	f.File.Close()
+	return os.Remove(f.File.Name())
+}
@@ -0,0 +1,66 @@
+//go:build unix
+
+package util_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/SDkie/rollinghash/pkg/util"
+)
+
+func TestCreateAtomicMode(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing fs.FileMode
+		umask    int
+		expMode  fs.FileMode
+	}{
+		// Happy Paths
+		{name: "New file with umask 077", umask: 0077, expMode: 0600},
+		{name: "New file with umask 022", umask: 0022, expMode: 0644},
+		{name: "Replaced file keeps its mode", existing: 0640, umask: 0077, expMode: 0640},
+	}
+
+	for _, c := range cases {
+		tf := func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "output")
+			if c.existing != 0 {
+				err := os.WriteFile(name, []byte("existing"), c.existing)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+				err = os.Chmod(name, c.existing)
+				if err != nil {
+					t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+				}
+			}
+
+			umask := syscall.Umask(c.umask)
+			defer syscall.Umask(umask)
+
+			f, err := util.CreateAtomic(name, true)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			defer f.Close()
+			err = f.Commit()
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+
+			stats, err := os.Stat(name)
+			if err != nil {
+				t.Fatalf("'%s' Failed with error: %v", t.Name(), err)
+			}
+			if stats.Mode().Perm() != c.expMode {
+				t.Fatalf("'%s' Failed : expected mode:%v, got:%v", t.Name(), c.expMode, stats.Mode().Perm())
+			}
+		}
+
+		t.Run(c.name, tf)
+	}
+}
@@ -1,21 +1,76 @@
 package util
 
 import (
-	"log"
+	"io"
+	"io/fs"
 	"os"
+	"time"
 )
 
+// StdioName is the file name of stdin for the input files and of stdout for the output files
+const StdioName = "-"
+
+// Stdin returns r, or os.Stdin when r is nil
+func Stdin(r io.Reader) io.Reader {
+	if r == nil {
+		return os.Stdin
+	}
+	return r
+}
+
+// Stdout returns w, or os.Stdout when w is nil
+func Stdout(w io.Writer) io.Writer {
+	if w == nil {
+		return os.Stdout
+	}
+	return w
+}
+
+// IsEmpty reports whether the file of stats is an empty regular file,
+// the size of pipes and other files is not known and they are never reported empty
+func IsEmpty(stats fs.FileInfo) bool {
+	return stats.Mode().IsRegular() && stats.Size() == 0
+}
+
+// Size reports the size of r if it can be known without reading it,
+// that is when r has a Size method (bytes.Reader, io.SectionReader...)
+// or is a regular file
+func Size(r any) (int64, bool) {
+	switch v := r.(type) {
+	case interface{ Size() int64 }:
+		return v.Size(), true
+	case interface{ Stat() (fs.FileInfo, error) }:
+		stats, err := v.Stat()
+		if err != nil || !stats.Mode().IsRegular() {
+			return 0, false
+		}
+		return stats.Size(), true
+	}
+	return 0, false
+}
+
+// ModTime reports the modification time of r when it is a regular file
+func ModTime(r any) (time.Time, bool) {
+	f, ok := r.(interface{ Stat() (fs.FileInfo, error) })
+	if !ok {
+		return time.Time{}, false
+	}
+	stats, err := f.Stat()
+	if err != nil || !stats.Mode().IsRegular() {
+		return time.Time{}, false
+	}
+	return stats.ModTime(), true
+}
+
 // CompareFileContents reports whether contents of two files are the same or not
 func CompareFileContents(file1, file2 string) (bool, error) {
 	data1, err := os.ReadFile(file1)
 	if err != nil {
-		log.Printf("error reading %s: %s", file1, err)
 		return false, err
 	}
 
 	data2, err := os.ReadFile(file2)
 	if err != nil {
-		log.Printf("error reading %s: %s", file2, err)
 		return false, err
 	}
 
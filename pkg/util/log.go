@@ -0,0 +1,22 @@
+package util
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Logger returns l, or a logger discarding all the records when l is nil
+func Logger(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.New(discardHandler{})
+	}
+	return l
+}
+
+// discardHandler is a slog.Handler which is never enabled
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
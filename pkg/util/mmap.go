@@ -0,0 +1,55 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// ErrMmapUnsupported is returned by Mmap for files which can't be memory mapped
+var ErrMmapUnsupported = errors.New("file can't be memory mapped")
+
+// MappedFile is a read only memory mapping of a whole file
+// It reads like a bytes.Reader, Bytes returns the mapped memory without copying it.
+type MappedFile struct {
+	*bytes.Reader
+	data  []byte
+	stats fs.FileInfo
+}
+
+// Mmap maps the whole file f in memory
+// It returns ErrMmapUnsupported for pipes, empty files and on platforms without mmap,
+// the caller should read f instead.
+func Mmap(f *os.File) (*MappedFile, error) {
+	stats, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stats.Size()
+	if !stats.Mode().IsRegular() || size == 0 || int64(int(size)) != size {
+		return nil, ErrMmapUnsupported
+	}
+
+	data, err := mmap(f, int(size))
+	if err != nil {
+		return nil, err
+	}
+	return &MappedFile{Reader: bytes.NewReader(data), data: data, stats: stats}, nil
+}
+
+// Bytes returns the whole mapped file, whatever was already read
+// The bytes are only valid until Close.
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+// Stat returns the stats of the file mapped when it was mapped
+func (m *MappedFile) Stat() (fs.FileInfo, error) {
+	return m.stats, nil
+}
+
+// Close unmaps the file, it doesn't close the file mapped
+func (m *MappedFile) Close() error {
+	return munmap(m.data)
+}
@@ -0,0 +1,16 @@
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of f read only
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap unmaps memory returned by mmap
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
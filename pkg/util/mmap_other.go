@@ -0,0 +1,15 @@
+//go:build !linux
+
+package util
+
+import "os"
+
+// mmap is only supported on linux
+func mmap(f *os.File, size int) ([]byte, error) {
+	return nil, ErrMmapUnsupported
+}
+
+// munmap is only supported on linux
+func munmap(data []byte) error {
+	return nil
+}